@@ -1,6 +1,7 @@
 package spectral
 
 import (
+	"cmp"
 	"slices"
 	"time"
 
@@ -24,25 +25,27 @@ func (a *ackQueue) next() (t time.Time) {
 }
 
 func (a *ackQueue) add(now time.Time, sequenceID uint32) {
-	for i, r := range a.ranges {
-		if sequenceID >= r[0] && sequenceID <= r[1] {
-			return
-		}
-
-		if sequenceID == r[1]+1 {
-			a.ranges[i][1] = sequenceID
-			a.merge()
-			return
-		}
+	i, found := slices.BinarySearchFunc(a.ranges, sequenceID, func(r frame.AcknowledgementRange, sequenceID uint32) int {
+		return cmp.Compare(r[0], sequenceID)
+	})
+	if found || (i > 0 && sequenceID <= a.ranges[i-1][1]) {
+		return
+	}
 
-		if sequenceID+1 == r[0] {
-			a.ranges[i][0] = sequenceID
-			a.merge()
-			return
-		}
+	extendsPrevious := i > 0 && a.ranges[i-1][1]+1 == sequenceID
+	extendsNext := i < len(a.ranges) && sequenceID+1 == a.ranges[i][0]
+	switch {
+	case extendsPrevious && extendsNext:
+		a.ranges[i-1][1] = a.ranges[i][1]
+		a.ranges = slices.Delete(a.ranges, i, i+1)
+	case extendsPrevious:
+		a.ranges[i-1][1] = sequenceID
+	case extendsNext:
+		a.ranges[i][0] = sequenceID
+	default:
+		a.ranges = slices.Insert(a.ranges, i, frame.AcknowledgementRange{sequenceID, sequenceID})
 	}
 
-	a.ranges = append(a.ranges, frame.AcknowledgementRange{sequenceID, sequenceID})
 	if sequenceID > a.max {
 		a.max = sequenceID
 		a.maxTime = now
@@ -53,43 +56,23 @@ func (a *ackQueue) add(now time.Time, sequenceID uint32) {
 	}
 }
 
-func (a *ackQueue) merge() {
-	if len(a.ranges) <= 1 {
-		return
-	}
-
-	slices.SortFunc(a.ranges, func(a, b frame.AcknowledgementRange) int {
-		if a[0] < b[0] {
-			return -1
-		} else if a[0] > b[0] {
-			return 1
-		}
-		return 0
-	})
-	merged := make([]frame.AcknowledgementRange, 0, len(a.ranges))
-	current := a.ranges[0]
-	for _, next := range a.ranges[1:] {
-		if next[0] <= current[1]+1 {
-			current[1] = max(current[1], next[1])
-		} else {
-			merged = append(merged, current)
-			current = next
-		}
+func (a *ackQueue) expedite(now time.Time) {
+	if len(a.ranges) > 0 {
+		a.nextAck = now
 	}
-	a.ranges = append(merged, current)
 }
 
-func (a *ackQueue) flush(now time.Time, length int, append bool) (ranges []frame.AcknowledgementRange, maxSequenceID uint32, delay int64) {
+func (a *ackQueue) flush(now time.Time, dst []frame.AcknowledgementRange, length int, piggyback bool) (ranges []frame.AcknowledgementRange, maxSequenceID uint32, delay int64) {
 	length = min(len(a.ranges), length)
-	if length > 0 && (now.After(a.nextAck) || append) {
-		ranges = a.ranges[:length]
+	if length > 0 && (!a.nextAck.After(now) || piggyback) {
+		ranges = append(dst[:0], a.ranges[:length]...)
 		maxSequenceID = a.max
 		delay = now.Sub(a.maxTime).Microseconds()
 		if delay < 0 {
 			delay = 0
 		}
 
-		a.ranges = a.ranges[length:]
+		a.ranges = a.ranges[:copy(a.ranges, a.ranges[length:])]
 		if len(a.ranges) == 0 {
 			a.max = 0
 			a.maxTime = time.Time{}
@@ -0,0 +1,114 @@
+package spectral
+
+import (
+	"math"
+	"math/rand/v2"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/cooldogedev/spectral/internal/frame"
+	"github.com/cooldogedev/spectral/internal/protocol"
+)
+
+func TestAckQueueMerge(t *testing.T) {
+	now := time.Now()
+	a := newAckQueue()
+	for _, sequenceID := range rand.New(rand.NewPCG(1, 2)).Perm(1000) {
+		a.add(now, uint32(sequenceID)+1)
+	}
+
+	ranges, maxSequenceID, _ := a.flush(now, nil, 16, true)
+	if !slices.Equal(ranges, []frame.AcknowledgementRange{{1, 1000}}) {
+		t.Fatalf("expected a single range, got %v", ranges)
+	}
+
+	if maxSequenceID != 1000 {
+		t.Fatalf("expected max sequence id 1000, got %v", maxSequenceID)
+	}
+}
+
+func TestAckQueueGaps(t *testing.T) {
+	now := time.Now()
+	a := newAckQueue()
+	for _, sequenceID := range []uint32{9, 1, 5, 2, 6, 10, 2, 8} {
+		a.add(now, sequenceID)
+	}
+
+	expected := []frame.AcknowledgementRange{{1, 2}, {5, 6}, {8, 10}}
+	if ranges, _, _ := a.flush(now, nil, 2, true); !slices.Equal(ranges, expected[:2]) {
+		t.Fatalf("expected %v, got %v", expected[:2], ranges)
+	}
+
+	if ranges, _, _ := a.flush(now, nil, 2, true); !slices.Equal(ranges, expected[2:]) {
+		t.Fatalf("expected %v, got %v", expected[2:], ranges)
+	}
+
+	if !a.next().IsZero() {
+		t.Fatal("expected no pending ack after flushing every range")
+	}
+}
+
+func TestAckQueueDelay(t *testing.T) {
+	now := time.Now()
+	a := newAckQueue()
+	a.add(now, 1)
+	if ranges, _, _ := a.flush(now, nil, 16, false); len(ranges) != 0 {
+		t.Fatal("flushed an ack before its delay elapsed")
+	}
+
+	a.add(now.Add(time.Millisecond), 2)
+	deadline := a.next()
+	ranges, maxSequenceID, delay := a.flush(deadline, nil, 16, false)
+	if len(ranges) != 1 || maxSequenceID != 2 {
+		t.Fatalf("expected ranges up to 2, got %v with max %v", ranges, maxSequenceID)
+	}
+
+	if expected := deadline.Sub(now.Add(time.Millisecond)).Microseconds(); delay != expected {
+		t.Fatalf("expected delay of %vus, got %vus", expected, delay)
+	}
+}
+
+func benchmarkAckQueue(b *testing.B, reorder bool, lossInterval int) {
+	const window = 10_000
+	now := time.Now()
+	a := newAckQueue()
+	order := make([]uint32, window)
+	for i := range order {
+		order[i] = uint32(i)
+	}
+
+	if reorder {
+		r := rand.New(rand.NewPCG(1, 2))
+		for i := 0; i+8 <= window; i += 8 {
+			r.Shuffle(8, func(x, y int) { order[i+x], order[i+y] = order[i+y], order[i+x] })
+		}
+	}
+
+	var ranges []frame.AcknowledgementRange
+	b.ReportAllocs()
+	b.ResetTimer()
+	sequenceID := uint32(1)
+	for range b.N {
+		for i, offset := range order {
+			if (i+1)%lossInterval != 0 {
+				a.add(now, sequenceID+offset)
+			}
+		}
+
+		for {
+			flushed, _, _ := a.flush(now, ranges, protocol.MaxAckRanges, true)
+			if len(flushed) == 0 {
+				break
+			}
+			ranges = flushed
+		}
+		sequenceID += window
+	}
+}
+
+func BenchmarkAckQueue(b *testing.B) {
+	b.Run("InOrder", func(b *testing.B) { benchmarkAckQueue(b, false, math.MaxInt) })
+	b.Run("Reordered", func(b *testing.B) { benchmarkAckQueue(b, true, math.MaxInt) })
+	b.Run("Loss1%", func(b *testing.B) { benchmarkAckQueue(b, true, 100) })
+}
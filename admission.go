@@ -0,0 +1,91 @@
+package spectral
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/cooldogedev/spectral/internal/frame"
+)
+
+const (
+	subnetPrefixIPv4 = 24
+	subnetPrefixIPv6 = 64
+)
+
+type HandshakeParameters struct {
+	Version             uint32
+	IdleTimeout         time.Duration
+	MaxStreams          int
+	StreamReceiveWindow int
+	MaxUDPPayloadSize   int
+	Extensions          uint64
+}
+
+func newHandshakeParameters(request *frame.ConnectionRequest) HandshakeParameters {
+	return HandshakeParameters{
+		Version:             request.Version,
+		IdleTimeout:         time.Duration(request.Parameters.IdleTimeout) * time.Millisecond,
+		MaxStreams:          int(request.Parameters.MaxStreams),
+		StreamReceiveWindow: int(request.Parameters.StreamReceiveWindow),
+		MaxUDPPayloadSize:   int(request.Parameters.MaxDatagramSize),
+		Extensions:          request.Parameters.Extensions,
+	}
+}
+
+type admission struct {
+	ips     map[string]int
+	subnets map[string]int
+	mu      sync.Mutex
+}
+
+func newAdmission() *admission {
+	return &admission{
+		ips:     make(map[string]int),
+		subnets: make(map[string]int),
+	}
+}
+
+func (a *admission) reserve(addr net.Addr, maxPerIP, maxPerSubnet int) (reason string, ok bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	ip, subnet := addrKeys(addr)
+	if maxPerIP > 0 && a.ips[ip] >= maxPerIP {
+		return "too many connections from address", false
+	}
+
+	if maxPerSubnet > 0 && a.subnets[subnet] >= maxPerSubnet {
+		return "too many connections from subnet", false
+	}
+	a.ips[ip]++
+	a.subnets[subnet]++
+	return "", true
+}
+
+func (a *admission) remove(addr net.Addr) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	ip, subnet := addrKeys(addr)
+	decrement(a.ips, ip)
+	decrement(a.subnets, subnet)
+}
+
+func addrKeys(addr net.Addr) (ip string, subnet string) {
+	udpAddr, ok := addr.(*net.UDPAddr)
+	if !ok {
+		return addr.String(), addr.String()
+	}
+
+	if ip4 := udpAddr.IP.To4(); ip4 != nil {
+		return udpAddr.IP.String(), ip4.Mask(net.CIDRMask(subnetPrefixIPv4, 32)).String()
+	}
+	return udpAddr.IP.String(), udpAddr.IP.Mask(net.CIDRMask(subnetPrefixIPv6, 128)).String()
+}
+
+func decrement(m map[string]int, key string) {
+	if m[key] <= 1 {
+		delete(m, key)
+	} else {
+		m[key]--
+	}
+}
@@ -3,6 +3,7 @@ package spectral
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net"
 	"sync"
 
@@ -13,24 +14,44 @@ import (
 
 type ClientConnection struct {
 	*connection
-	response        chan *frame.ConnectionResponse
-	streamResponses map[protocol.StreamID]chan *frame.StreamResponse
+	response        chan frame.ConnectionResponse
+	streamResponses map[protocol.StreamID]chan frame.StreamResponse
 	streamID        protocol.StreamID
+	requestID       uint32
+	retried         bool
+	migration       *pathChallenge
+	migrated        chan struct{}
 	mu              sync.RWMutex
 }
 
-func newClientConnection(conn *udpConn, peerAddr *net.UDPAddr, ctx context.Context) *ClientConnection {
+func newClientConnection(conn *udpConn, peerAddr net.Addr, connectionID protocol.ConnectionID, ctx context.Context, config *Config) *ClientConnection {
 	c := &ClientConnection{
-		connection:      newConnection(conn, peerAddr, -1, ctx, log.PerspectiveClient),
-		response:        make(chan *frame.ConnectionResponse, 1),
-		streamResponses: make(map[protocol.StreamID]chan *frame.StreamResponse),
+		connection:      newConnection(conn, peerAddr, connectionID, connectionID, ctx, log.PerspectiveClient, config),
+		response:        make(chan frame.ConnectionResponse, 1),
+		streamResponses: make(map[protocol.StreamID]chan frame.StreamResponse),
 	}
 	c.connection.handler = c.handle
 	return c
 }
 
 func (c *ClientConnection) OpenStream(ctx context.Context) (*Stream, error) {
-	ch := make(chan *frame.StreamResponse, 1)
+	return c.OpenStreamWithPriority(ctx, DefaultStreamUrgency, true)
+}
+
+func (c *ClientConnection) OpenStreamWithPriority(ctx context.Context, urgency uint8, incremental bool) (*Stream, error) {
+	if c.goingAway() {
+		return nil, ErrGoAway
+	}
+
+	if c.sendQueue.stopped() {
+		return nil, ErrConnectionClosing
+	}
+
+	if parameters := c.peerParameters.Load(); parameters != nil && parameters.MaxStreams > 0 && uint64(c.streams.len()) >= parameters.MaxStreams {
+		return nil, errors.New("stream limit reached")
+	}
+
+	ch := make(chan frame.StreamResponse, 1)
 	c.mu.Lock()
 	streamID := c.streamID
 	c.streamID++
@@ -54,6 +75,9 @@ func (c *ClientConnection) OpenStream(ctx context.Context) (*Stream, error) {
 	case response := <-ch:
 		if response.Response == frame.StreamResponseFailed {
 			c.logger.Log("stream_open_fail", "streamID", streamID)
+			if c.goingAway() {
+				return nil, ErrGoAway
+			}
 			return nil, errors.New("failed to open stream")
 		}
 
@@ -61,27 +85,163 @@ func (c *ClientConnection) OpenStream(ctx context.Context) (*Stream, error) {
 		if err != nil {
 			return nil, err
 		}
+		stream.SetPriority(urgency, incremental)
 		c.logger.Log("stream_open_success", "streamID", streamID)
 		return stream, nil
 	}
 }
 
+func (c *ClientConnection) Migrate(ctx context.Context, address string) error {
+	if !c.conn.Load().supportsMigration() {
+		return errors.New("migration is only supported on dedicated udp sockets")
+	}
+
+	addr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return err
+	}
+
+	uConn, err := newUDPConn(conn, false, c.config.MaxUDPPayloadSize)
+	if err != nil {
+		_ = conn.Close()
+		return err
+	}
+
+	peerAddr := c.RemoteAddr()
+	challenge := newPathChallenge(peerAddr)
+	migrated := make(chan struct{}, 1)
+	c.mu.Lock()
+	if c.migration != nil {
+		c.mu.Unlock()
+		_ = uConn.Close()
+		return errors.New("migration already in progress")
+	}
+	c.migration = challenge
+	c.migrated = migrated
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		c.migration = nil
+		c.migrated = nil
+		c.mu.Unlock()
+	}()
+
+	go c.read(uConn)
+	c.logger.Log("migration_request", "addr", uConn.LocalAddr().String())
+	timer := c.clock.NewTimer(pathProbeInterval)
+	defer timer.Stop()
+	for {
+		if err := c.writePath(uConn, peerAddr, &frame.PathChallenge{Data: challenge.data}); err != nil {
+			_ = uConn.Close()
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			_ = uConn.Close()
+			c.logger.Log("migration_timeout")
+			return context.Cause(ctx)
+		case <-c.ctx.Done():
+			_ = uConn.Close()
+			return context.Cause(c.ctx)
+		case <-migrated:
+			prev := c.conn.Swap(uConn)
+			_ = prev.Close()
+			c.logger.Log("migration_success", "addr", uConn.LocalAddr().String())
+			return nil
+		case <-timer.C():
+			timer.Reset(pathProbeInterval)
+		}
+	}
+}
+
+func (c *ClientConnection) requestConnection(token []byte) error {
+	if c.requestID == 0 {
+		c.requestID = c.sequenceID.Add(1)
+	} else {
+		c.retransmission.remove(c.requestID)
+	}
+
+	pk := c.newPacket(c.requestID)
+	pk.b = frame.Append(pk.b, &frame.ConnectionRequest{Version: protocol.Version, Token: token, Parameters: c.transportParameters()})
+	if padding := protocol.MinPacketSize - len(pk.b) - 4; padding > 0 {
+		pk.b = frame.Append(pk.b, &frame.Padding{Length: padding})
+	}
+	return c.writePacket(c.requestID, pk)
+}
+
+func (c *ClientConnection) read(conn *udpConn) {
+	var reader frame.Reader
+	conn.Read(func(dgram *datagram) (err error) {
+		_, sequenceID, _, err := unpack(&reader, dgram.b, c.logger)
+		if err != nil {
+			dgram.reset()
+			c.logger.Log("unpack_err", "err", err.Error())
+			return nil
+		}
+
+		select {
+		case <-c.done:
+			dgram.reset()
+			return net.ErrClosed
+		default:
+			c.deliver(newReceivedPacket(dgram, sequenceID, c.clock.Now()))
+			return
+		}
+	})
+}
+
 func (c *ClientConnection) handle(fr frame.Frame) (err error) {
 	switch fr := fr.(type) {
 	case *frame.ConnectionResponse:
-		c.response <- fr
+		c.retransmission.remove(c.requestID)
+		if fr.Response == frame.ConnectionResponseSuccess && fr.Version != protocol.Version {
+			fr.Response = frame.ConnectionResponseFailed
+			fr.Reason = fmt.Sprintf("unsupported protocol version %v, expected %v", fr.Version, protocol.Version)
+		}
+
+		if fr.Response == frame.ConnectionResponseSuccess && !c.negotiate(c.clock.Now(), fr.Parameters) {
+			return
+		}
+
+		select {
+		case c.response <- *fr:
+		default:
+		}
+	case *frame.Retry:
+		if c.retried {
+			c.logger.Log("connection_retry_duplicate")
+			return
+		}
+		c.retried = true
+		c.logger.Log("connection_retry")
+		return c.requestConnection(fr.Token)
 	case *frame.StreamResponse:
 		c.mu.RLock()
 		ch, ok := c.streamResponses[fr.StreamID]
 		c.mu.RUnlock()
 		if ok {
 			select {
-			case ch <- fr:
+			case ch <- *fr:
 			default:
 			}
 		} else {
 			c.logger.Log("stream_response_unknown", "streamID", fr.StreamID)
 		}
+	case *frame.PathResponse:
+		c.mu.RLock()
+		if c.migration != nil && c.migration.data == fr.Data {
+			select {
+			case c.migrated <- struct{}{}:
+			default:
+			}
+		}
+		c.mu.RUnlock()
 	}
 	return
 }
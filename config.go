@@ -0,0 +1,102 @@
+package spectral
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/cooldogedev/spectral/internal/clock"
+	"github.com/cooldogedev/spectral/internal/protocol"
+)
+
+const (
+	defaultIdleTimeout             = time.Second * 30
+	defaultStreamReceiveWindow     = 1024 * 1024
+	defaultStreamSendWindow        = 1024 * 1024
+	defaultAcceptQueueLength       = 100
+	defaultStreamAcceptQueueLength = 100
+)
+
+type Config struct {
+	MaxUDPPayloadSize   int
+	IdleTimeout         time.Duration
+	KeepAlivePeriod     time.Duration
+	MaxStreams          int
+	StreamReceiveWindow int
+	StreamSendWindow    int
+
+	RequireAddressValidation bool
+	MaxConnectionsPerIP      int
+	MaxConnectionsPerSubnet  int
+	AdmitAddress             func(addr net.Addr) error
+	AdmitConnection          func(addr net.Addr, parameters HandshakeParameters) error
+	AcceptQueueLength        int
+	StreamAcceptQueueLength  int
+	Shards                   int
+	Clock                    clock.Clock
+}
+
+func populateConfig(config *Config) (*Config, error) {
+	c := &Config{}
+	if config != nil {
+		*c = *config
+	}
+
+	if c.MaxUDPPayloadSize == 0 {
+		c.MaxUDPPayloadSize = protocol.MaxUDPPayloadSize
+	}
+
+	if c.Clock == nil {
+		c.Clock = clock.Wall
+	}
+
+	if c.IdleTimeout == 0 {
+		c.IdleTimeout = defaultIdleTimeout
+	}
+
+	if c.StreamReceiveWindow == 0 {
+		c.StreamReceiveWindow = defaultStreamReceiveWindow
+	}
+
+	if c.StreamSendWindow == 0 {
+		c.StreamSendWindow = defaultStreamSendWindow
+	}
+
+	if c.AcceptQueueLength == 0 {
+		c.AcceptQueueLength = defaultAcceptQueueLength
+	}
+
+	if c.StreamAcceptQueueLength == 0 {
+		c.StreamAcceptQueueLength = defaultStreamAcceptQueueLength
+	}
+
+	if c.Shards == 0 {
+		c.Shards = 1
+	}
+
+	if c.Shards < 0 {
+		return nil, errors.New("shards must not be negative")
+	}
+
+	if c.AcceptQueueLength < 0 || c.StreamAcceptQueueLength < 0 {
+		return nil, errors.New("accept queue lengths must not be negative")
+	}
+
+	if c.IdleTimeout < 0 || c.KeepAlivePeriod < 0 {
+		return nil, errors.New("idle timeout and keep-alive period must not be negative")
+	}
+
+	if c.MaxStreams < 0 || c.StreamReceiveWindow < 0 || c.StreamSendWindow < 0 {
+		return nil, errors.New("max streams and stream windows must not be negative")
+	}
+
+	if c.MaxUDPPayloadSize < protocol.MinUDPPayloadSize || c.MaxUDPPayloadSize > protocol.MaxUDPPayloadSizeLimit {
+		return nil, fmt.Errorf("max udp payload size must be between %d and %d", protocol.MinUDPPayloadSize, protocol.MaxUDPPayloadSizeLimit)
+	}
+	return c, nil
+}
+
+func (c *Config) maxPacketSize() uint64 {
+	return uint64(c.MaxUDPPayloadSize - protocol.PacketOverhead)
+}
@@ -6,68 +6,119 @@ import (
 	"fmt"
 	"math"
 	"net"
+	"slices"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/cooldogedev/spectral/internal/clock"
 	"github.com/cooldogedev/spectral/internal/congestion"
+	"github.com/cooldogedev/spectral/internal/deadline"
 	"github.com/cooldogedev/spectral/internal/frame"
 	"github.com/cooldogedev/spectral/internal/log"
 	"github.com/cooldogedev/spectral/internal/protocol"
 )
 
 const (
-	deadlineInf       = time.Duration(math.MaxInt64)
 	deadlineImmediate = protocol.TimerGranularity
-	inactivityTimeout = time.Second * 30
+
+	amplificationFactor = 3
+	closingPeriod       = 3
+)
+
+var (
+	errIdleTimeout        = errors.New("network inactivity")
+	errAmplificationLimit = errors.New("amplification limit reached")
 )
 
-type receivedPacket struct {
+type closeError struct {
+	code    byte
+	message string
+	remote  bool
+}
+
+func (e *closeError) Error() string {
+	return e.message
+}
+
+type deferredPacket struct {
 	sequenceID uint32
-	frames     []frame.Frame
-	t          time.Time
+	pk         *packet
+	length     uint64
 }
 
 type Connection interface {
 	AcceptStream(ctx context.Context) (*Stream, error)
 	OpenStream(ctx context.Context) (*Stream, error)
+	OpenStreamWithPriority(ctx context.Context, urgency uint8, incremental bool) (*Stream, error)
 	CloseWithError(code byte, message string) error
+	Ping(ctx context.Context) (time.Duration, error)
+	GoingAway() <-chan struct{}
 	Context() context.Context
+	LocalAddr() net.Addr
+	RemoteAddr() net.Addr
 }
 
 var _ Connection = &connection{}
 
 type connection struct {
-	conn           *udpConn
-	peerAddr       *net.UDPAddr
-	connectionID   atomic.Int64
-	sequenceID     atomic.Uint32
-	ctx            context.Context
-	cancelFunc     context.CancelCauseFunc
-	sender         *congestion.Sender
-	packets        chan *receivedPacket
-	ack            *ackQueue
-	receiveQueue   *receiveQueue
-	retransmission *retransmissionQueue
-	sendQueue      *sendQueue
-	streams        *streamMap
-	discovery      *mtuDiscovery
-	rtt            *congestion.RTT
-	handler        func(frame.Frame) error
-	notify         chan struct{}
-	idle           time.Time
-	pacingDeadline time.Time
-	once           sync.Once
-	logger         log.Logger
-}
-
-func newConnection(conn *udpConn, peerAddr *net.UDPAddr, connectionID protocol.ConnectionID, parentCtx context.Context, perspective log.Perspective) *connection {
-	now := time.Now()
+	config          *Config
+	clock           clock.Clock
+	conn            atomic.Pointer[udpConn]
+	peerAddr        atomic.Value
+	perspective     log.Perspective
+	connectionID    atomic.Int64
+	peerID          protocol.ConnectionID
+	sequenceID      atomic.Uint32
+	bytesReceived   atomic.Uint64
+	bytesSent       atomic.Uint64
+	validated       atomic.Bool
+	ctx             context.Context
+	cancelFunc      context.CancelCauseFunc
+	sender          *congestion.Sender
+	packets         chan *receivedPacket
+	ack             *ackQueue
+	receiveQueue    *receiveQueue
+	retransmission  *retransmissionQueue
+	sendQueue       *sendQueue
+	streams         *streamMap
+	discovery       *mtuDiscovery
+	rtt             *congestion.RTT
+	peerParameters  atomic.Pointer[frame.TransportParameters]
+	acknowledgement frame.Acknowledgement
+	reader          frame.Reader
+	path            *pathChallenge
+	pathMigrated    time.Time
+	handler         func(frame.Frame) error
+	notify          chan struct{}
+	closeRequests   chan *closeError
+	closing         *closeError
+	closed          chan struct{}
+	done            chan struct{}
+	goAway          chan struct{}
+	goAwayOnce      sync.Once
+	pings           map[uint32]chan time.Duration
+	pingsMu         sync.Mutex
+	idle            time.Time
+	idleTimeout     time.Duration
+	keepAlive       time.Time
+	keepAlivePeriod time.Duration
+	pacingDeadline  time.Time
+	deferred        []deferredPacket
+	deferredMu      sync.Mutex
+	once            sync.Once
+	logger          log.Logger
+}
+
+func newConnection(conn *udpConn, peerAddr net.Addr, connectionID, peerID protocol.ConnectionID, parentCtx context.Context, perspective log.Perspective, config *Config) *connection {
+	now := config.Clock.Now()
 	logger := log.NewLogger(perspective)
 	ctx, cancelFunc := context.WithCancelCause(parentCtx)
 	c := &connection{
-		conn:           conn,
-		peerAddr:       peerAddr,
+		config:         config,
+		clock:          config.Clock,
+		perspective:    perspective,
+		peerID:         peerID,
 		ctx:            ctx,
 		cancelFunc:     cancelFunc,
 		sender:         congestion.NewSender(logger, now, protocol.MinPacketSize),
@@ -75,15 +126,25 @@ func newConnection(conn *udpConn, peerAddr *net.UDPAddr, connectionID protocol.C
 		ack:            newAckQueue(),
 		receiveQueue:   newReceiveQueue(),
 		retransmission: newRetransmissionQueue(),
-		sendQueue:      newSendQueue(),
+		sendQueue:      newSendQueue(newPacketPool(config.maxPacketSize())),
 		streams:        newStreamMap(),
 		notify:         make(chan struct{}, 1),
-		idle:           now.Add(inactivityTimeout),
+		closeRequests:  make(chan *closeError, 1),
+		closed:         make(chan struct{}),
+		done:           make(chan struct{}),
+		goAway:         make(chan struct{}),
+		pings:          make(map[uint32]chan time.Duration),
+		idle:           now.Add(config.IdleTimeout),
+		idleTimeout:    config.IdleTimeout,
 		rtt:            congestion.NewRTT(),
 		logger:         logger,
 	}
+	c.conn.Store(conn)
+	c.peerAddr.Store(peerAddr)
+	c.validated.Store(perspective == log.PerspectiveClient)
 	c.connectionID.Store(int64(connectionID))
-	c.discovery = newMTUDiscovery(now, func(mtu uint64) {
+	c.setKeepAlive(now, config.KeepAlivePeriod)
+	c.discovery = newMTUDiscovery(now, config.maxPacketSize(), func(mtu uint64) {
 		c.sender.SetMSS(mtu)
 		c.sendQueue.setMSS(mtu)
 		c.logger.Log("mtu_update", "new", mtu)
@@ -100,18 +161,56 @@ func (c *connection) OpenStream(_ context.Context) (*Stream, error) {
 	return nil, errors.New("method not implemented")
 }
 
+func (c *connection) OpenStreamWithPriority(_ context.Context, _ uint8, _ bool) (*Stream, error) {
+	return nil, errors.New("method not implemented")
+}
+
 func (c *connection) LocalAddr() net.Addr {
-	return c.conn.LocalAddr()
+	return c.conn.Load().LocalAddr()
 }
 
 func (c *connection) RemoteAddr() net.Addr {
-	return c.peerAddr
+	return c.peerAddr.Load().(net.Addr)
 }
 
 func (c *connection) CloseWithError(code byte, message string) (err error) {
-	_ = c.writeControl(&frame.ConnectionClose{Code: code, Message: message}, true)
-	c.logger.Log("connection_close_err", "code", code, "message", message)
-	return c.close(message)
+	select {
+	case c.closeRequests <- &closeError{code: code, message: message}:
+		c.logger.Log("connection_close_err", "code", code, "message", message)
+	default:
+	}
+	<-c.closed
+	return
+}
+
+func (c *connection) Ping(ctx context.Context) (time.Duration, error) {
+	ch := make(chan time.Duration, 1)
+	c.pingsMu.Lock()
+	sequenceID := c.sequenceID.Add(1)
+	c.pings[sequenceID] = ch
+	c.pingsMu.Unlock()
+	defer func() {
+		c.pingsMu.Lock()
+		delete(c.pings, sequenceID)
+		c.pingsMu.Unlock()
+	}()
+
+	if err := c.writeSequenced(sequenceID, &frame.Ping{}); err != nil {
+		return 0, err
+	}
+
+	select {
+	case <-ctx.Done():
+		return 0, context.Cause(ctx)
+	case <-c.ctx.Done():
+		return 0, context.Cause(c.ctx)
+	case rtt := <-ch:
+		return rtt, nil
+	}
+}
+
+func (c *connection) GoingAway() <-chan struct{} {
+	return c.goAway
 }
 
 func (c *connection) Context() context.Context {
@@ -119,11 +218,14 @@ func (c *connection) Context() context.Context {
 }
 
 func (c *connection) run(now time.Time) {
-	var lastDeadline time.Time
-	timer := time.NewTimer(deadlineInf)
+	var (
+		lastDeadline time.Time
+		err          error
+	)
+	timer := c.clock.NewTimer(deadline.Inf)
 	defer func() {
 		timer.Stop()
-		_ = c.CloseWithError(frame.ConnectionCloseInternal, "")
+		c.terminate(err)
 		c.cleanup()
 	}()
 
@@ -131,11 +233,17 @@ runLoop:
 	for {
 		select {
 		case <-c.ctx.Done():
+			err = context.Cause(c.ctx)
 			return
 		default:
 		}
 
-		if err := c.maybeSend(now); err != nil {
+		if err = c.maybeSend(now); err != nil {
+			break runLoop
+		}
+
+		if c.closing != nil && !c.sendQueue.available() && c.retransmission.len() == 0 && !c.hasDeferred() {
+			err = c.closing
 			break runLoop
 		}
 
@@ -144,10 +252,12 @@ runLoop:
 			c.ack.next(),
 			c.retransmission.next(c.rtt.RTO()),
 			c.pacingDeadline,
+			c.keepAlive,
+			c.nextProbe(),
 		)
-		if !nextDeadline.IsZero() && nextDeadline.Before(now) {
-			now = time.Now()
-			if err := c.triggerTimer(now); err != nil {
+		if !nextDeadline.IsZero() && !nextDeadline.After(now) {
+			now = c.clock.Now()
+			if err = c.triggerTimer(now); err != nil {
 				break runLoop
 			}
 			continue
@@ -158,11 +268,22 @@ runLoop:
 
 		select {
 		case <-c.ctx.Done():
+			err = context.Cause(c.ctx)
 			return
+		case closeErr := <-c.closeRequests:
+			if c.closing != nil {
+				continue
+			}
+			now = c.clock.Now()
+			c.closing = closeErr
+			c.idle = now.Add(closingPeriod * c.rtt.RTO())
+			c.sendQueue.stopWrites()
+			c.ack.expedite(now)
 		case first := <-c.packets:
-			now = time.Now()
-			c.idle = now.Add(inactivityTimeout)
-			if err := c.receive(now, first.t, first.sequenceID, first.frames); err != nil {
+			now = c.clock.Now()
+			c.resetIdle(now)
+			c.setKeepAlive(now, c.keepAlivePeriod)
+			if err = c.receive(now, first); err != nil {
 				break runLoop
 			}
 
@@ -171,12 +292,13 @@ runLoop:
 			for i := 0; i < totalPackets; i++ {
 				select {
 				case pk := <-c.packets:
-					if err := c.receive(now, pk.t, pk.sequenceID, pk.frames); err != nil {
+					if err = c.receive(now, pk); err != nil {
 						break runLoop
 					}
 
 					select {
 					case <-c.ctx.Done():
+						err = context.Cause(c.ctx)
 						break runLoop
 					default:
 					}
@@ -184,77 +306,199 @@ runLoop:
 					break receiveLoop
 				}
 			}
-		case <-timer.C:
-			now = time.Now()
-			if err := c.triggerTimer(now); err != nil {
+		case <-timer.C():
+			now = c.clock.Now()
+			if err = c.triggerTimer(now); err != nil {
 				break runLoop
 			}
 		case <-c.notify:
-			now = time.Now()
+			now = c.clock.Now()
+		}
+	}
+}
+
+func (c *connection) terminate(err error) {
+	var closeErr *closeError
+	switch {
+	case errors.As(err, &closeErr) && closeErr.remote:
+		c.logger.Log("connection_draining", "code", closeErr.code, "message", closeErr.message)
+		c.shutdown(closeErr.message)
+		c.linger(nil)
+	case errors.Is(err, errIdleTimeout):
+		_ = c.writeClose(frame.ConnectionCloseTimeout, err.Error())
+		c.shutdown(err.Error())
+	case c.ctx.Err() != nil:
+		c.shutdown(context.Cause(c.ctx).Error())
+	default:
+		code, message := byte(frame.ConnectionCloseInternal), err.Error()
+		if closeErr != nil {
+			code, message = closeErr.code, closeErr.message
+		}
+		c.flushPending(c.clock.Now())
+		pk := c.writeClose(code, message)
+		c.logger.Log("connection_closing", "code", code, "message", message)
+		c.shutdown(message)
+		c.linger(pk)
+	}
+}
+
+func (c *connection) flushPending(now time.Time) {
+	for c.sendQueue.available() {
+		pk := c.sendQueue.pack(math.MaxUint64)
+		if pk == nil || len(pk.b) == protocol.PacketHeaderSize {
+			break
+		}
+
+		c.sendQueue.flush()
+		frame.AppendHeader(pk.b[:0], c.destinationID(), c.sequenceID.Add(1))
+		_, err := c.writeDatagram(c.appendAcknowledgements(now, pk.b))
+		pk.release()
+		if err != nil {
+			return
+		}
+	}
+	c.ack.expedite(now)
+	_ = c.acknowledge(now)
+}
+
+func (c *connection) writeClose(code byte, message string) []byte {
+	pk := frame.Pack(c.destinationID(), 0, frame.PackSingle(&frame.ConnectionClose{Code: code, Message: message}))
+	_, _ = c.writeDatagram(pk)
+	return pk
+}
+
+func (c *connection) linger(pk []byte) {
+	timer := c.clock.NewTimer(closingPeriod * c.rtt.RTO())
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C():
+			return
+		case received := <-c.packets:
+			received.release()
+			if pk != nil {
+				_, _ = c.conn.Load().Write(pk, c.RemoteAddr())
+			}
 		}
 	}
 }
 
 func (c *connection) triggerTimer(now time.Time) (err error) {
-	if !c.idle.After(now) {
-		_ = c.CloseWithError(frame.ConnectionCloseTimeout, "network inactivity")
-		return errors.New("network inactivity")
+	if !c.idle.After(now) && c.closing != nil {
+		return c.closing
+	} else if !c.idle.After(now) {
+		return errIdleTimeout
+	}
+
+	if !c.keepAlive.IsZero() && !c.keepAlive.After(now) {
+		c.setKeepAlive(now, c.keepAlivePeriod)
+		c.logger.Log("keep_alive")
+		if err := c.writeControl(&frame.Ping{}, true); err != nil {
+			return err
+		}
 	}
 
-	if pk, t := c.retransmission.shift(now, c.rtt.RTO()); len(pk) > 0 {
+	if pk, t, dropped := c.retransmission.shift(now, c.rtt.RTO()); pk != nil {
 		c.sender.OnCongestionEvent(now, t)
-		if _, err := c.writeDatagram(pk); err != nil {
+		_, err := c.writeDatagram(pk.b)
+		if dropped {
+			pk.release()
+		}
+
+		if err != nil && !errors.Is(err, errAmplificationLimit) {
 			return err
 		}
 	}
 	return
 }
 
-func (c *connection) receive(now, t time.Time, sequenceID uint32, frames []frame.Frame) (err error) {
-	if sequenceID != 0 {
-		c.ack.add(t, sequenceID)
-		if !c.receiveQueue.add(sequenceID) {
-			c.logger.Log("duplicate_receive", "sequenceID", sequenceID)
+func (c *connection) receive(now time.Time, pk *receivedPacket) (err error) {
+	defer pk.release()
+	probing, err := c.validate(pk.frames())
+	if err != nil {
+		c.logger.Log("packet_dropped", "err", err.Error())
+		return nil
+	}
+
+	if c.perspective == log.PerspectiveServer && !probing && pk.sequenceID > c.receiveQueue.largest && !addrEqual(pk.addr, c.RemoteAddr()) {
+		if err := c.probePath(now, pk.addr); err != nil {
+			return err
+		}
+	}
+
+	if pk.sequenceID != 0 {
+		c.ack.add(pk.t, pk.sequenceID)
+		if !c.receiveQueue.add(pk.sequenceID) {
+			c.logger.Log("duplicate_receive", "sequenceID", pk.sequenceID)
 			return
 		}
 	}
 
-	for _, fr := range frames {
+	for p := pk.frames(); len(p) > 0; {
+		fr, n, _ := c.reader.Next(p)
+		p = p[n:]
+
 		if err := c.handler(fr); err != nil {
 			return err
 		}
 
-		if err := c.handle(now, fr); err != nil {
+		if err := c.handle(now, pk.addr, fr); err != nil {
 			return err
 		}
 	}
 	return
 }
 
-func (c *connection) handle(now time.Time, fr frame.Frame) (err error) {
+func (c *connection) validate(p []byte) (probing bool, err error) {
+	probing = true
+	for len(p) > 0 {
+		fr, n, err := next(&c.reader, p, c.logger)
+		if err != nil {
+			return false, err
+		}
+
+		switch fr := fr.(type) {
+		case *frame.PathChallenge, *frame.PathResponse, *frame.Padding:
+		case *frame.StreamData:
+			if stream := c.streams.get(fr.StreamID); stream != nil && !stream.accepts(fr.SequenceID, len(fr.Payload)) {
+				return false, fmt.Errorf("stream %v segment %v outside the receive window", fr.StreamID, fr.SequenceID)
+			}
+			probing = false
+		default:
+			probing = false
+		}
+		p = p[n:]
+	}
+	return
+}
+
+func (c *connection) handle(now time.Time, addr net.Addr, fr frame.Frame) (err error) {
 	switch fr := fr.(type) {
 	case *frame.Acknowledgement:
 		for _, r := range fr.Ranges {
-			for i := r[0]; i <= r[1]; i++ {
-				if entry := c.retransmission.remove(i); entry != nil {
+			from, to := c.retransmission.bounds(r[0], r[1])
+			for i := from; i < to; i++ {
+				if entry, ok := c.retransmission.remove(i); ok {
+					delay := time.Microsecond * time.Duration(fr.Delay)
 					if i == fr.Max {
-						c.rtt.Add(now.Sub(entry.sent), time.Microsecond*time.Duration(fr.Delay))
+						c.rtt.Add(now.Sub(entry.sent), delay)
+					} else {
+						delay = 0
 					}
-					c.sender.OnAck(now, entry.sent, c.rtt, uint64(len(entry.payload))-protocol.PacketHeaderSize)
+					c.onPingAck(i, now.Sub(entry.sent)-delay)
+					c.sender.OnAck(now, entry.sent, c.rtt, entry.size)
 				}
 			}
 		}
 	case *frame.ConnectionClose:
-		if err := c.close(fr.Message); err != nil {
-			return err
-		}
+		return &closeError{code: fr.Code, message: fr.Message, remote: true}
 	case *frame.StreamData:
 		if stream := c.streams.get(fr.StreamID); stream != nil {
 			stream.receive(fr.SequenceID, fr.Payload)
 		}
 	case *frame.StreamClose:
 		if stream := c.streams.get(fr.StreamID); stream != nil {
-			_ = stream.internalClose("closed by peer")
+			_ = stream.internalClose(errStreamClosedByPeer)
 			c.logger.Log("stream_close_request", "streamID", fr.StreamID)
 		}
 	case *frame.MTURequest:
@@ -263,17 +507,38 @@ func (c *connection) handle(now time.Time, fr frame.Frame) (err error) {
 		}
 	case *frame.MTUResponse:
 		c.discovery.onAck(fr.MTU)
+	case *frame.PathChallenge:
+		if err := c.writePath(c.conn.Load(), addr, &frame.PathResponse{Data: fr.Data}); err != nil {
+			return err
+		}
+	case *frame.PathResponse:
+		c.validatePath(now, fr.Data)
+	case *frame.Ping:
+		c.ack.expedite(now)
+	case *frame.GoAway:
+		c.markGoingAway()
+		c.logger.Log("go_away_received")
+	}
+	return
+}
+
+func (c *connection) nextProbe() (t time.Time) {
+	if c.conn.Load().mtud {
+		return c.discovery.next(c.rtt.SRTT())
 	}
-	frame.PutFrame(fr)
 	return
 }
 
 func (c *connection) maybeSend(now time.Time) (err error) {
-	if c.conn.mtud && !c.discovery.discovered && c.discovery.sendProbe(now, c.rtt.SRTT()) {
+	if c.conn.Load().mtud && !c.discovery.discovered && c.discovery.sendProbe(now, c.rtt.SRTT()) {
 		_ = c.writeControl(&frame.MTURequest{MTU: c.discovery.current}, false)
 		c.logger.Log("mtu_probe", "new", c.discovery.current)
 	}
 
+	if err := c.sendDeferred(now); err != nil {
+		return err
+	}
+
 	for c.sendQueue.available() {
 		wouldBlock, err := c.transmit(now)
 		if err != nil {
@@ -285,28 +550,32 @@ func (c *connection) maybeSend(now time.Time) (err error) {
 		}
 	}
 
-	if !c.sendQueue.available() {
+	if !c.sendQueue.available() || c.hasDeferred() {
 		c.pacingDeadline = time.Time{}
-	} else if c.pacingDeadline.IsZero() || now.After(c.pacingDeadline) {
+	} else if c.pacingDeadline.IsZero() || !now.Before(c.pacingDeadline) {
 		c.pacingDeadline = now.Add(deadlineImmediate)
 	}
 	return c.acknowledge(now)
 }
 
 func (c *connection) transmit(now time.Time) (wouldBlock bool, err error) {
+	if c.hasDeferred() {
+		return true, nil
+	}
+
 	available := c.sender.Available()
 	if available == 0 {
 		c.logger.Log("congestion_block", "window", available)
 		return true, nil
 	}
 
-	p := c.sendQueue.pack(available)
-	length := uint64(len(p))
-	if length == 0 {
+	pk := c.sendQueue.pack(available)
+	if pk == nil || len(pk.b) == protocol.PacketHeaderSize {
 		c.logger.Log("congestion_block", "window", available)
 		return true, nil
 	}
 
+	length := uint64(len(pk.b) - protocol.PacketHeaderSize)
 	if t := c.sender.TimeUntilSend(now, c.rtt, length); !t.IsZero() && t.After(now) {
 		c.pacingDeadline = t
 		c.logger.Log("pacer_block", "len", length, "window", available)
@@ -314,9 +583,13 @@ func (c *connection) transmit(now time.Time) (wouldBlock bool, err error) {
 	}
 
 	sequenceID := c.sequenceID.Add(1)
-	pk := frame.Pack(protocol.ConnectionID(c.connectionID.Load()), sequenceID, p)
 	c.sendQueue.flush()
-	if _, err := c.writeDatagram(c.appendAcknowledgements(now, pk)); err != nil {
+	frame.AppendHeader(pk.b[:0], c.destinationID(), sequenceID)
+	if _, err := c.writeDatagram(c.appendAcknowledgements(now, pk.b)); errors.Is(err, errAmplificationLimit) {
+		c.deferPacket(deferredPacket{sequenceID: sequenceID, pk: pk, length: length})
+		return true, nil
+	} else if err != nil {
+		pk.release()
 		return false, err
 	}
 	c.sender.OnSend(length)
@@ -324,22 +597,56 @@ func (c *connection) transmit(now time.Time) (wouldBlock bool, err error) {
 	return
 }
 
+func (c *connection) deferPacket(d deferredPacket) {
+	c.deferredMu.Lock()
+	c.deferred = append(c.deferred, d)
+	c.deferredMu.Unlock()
+}
+
+func (c *connection) hasDeferred() bool {
+	c.deferredMu.Lock()
+	defer c.deferredMu.Unlock()
+	return len(c.deferred) > 0
+}
+
+func (c *connection) sendDeferred(now time.Time) error {
+	c.deferredMu.Lock()
+	defer c.deferredMu.Unlock()
+	for len(c.deferred) > 0 {
+		d := c.deferred[0]
+		if _, err := c.writeDatagram(d.pk.b); errors.Is(err, errAmplificationLimit) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		c.deferred = slices.Delete(c.deferred, 0, 1)
+		if d.length > 0 {
+			c.sender.OnSend(d.length)
+		}
+		c.retransmission.add(now, d.sequenceID, d.pk)
+	}
+	return nil
+}
+
 func (c *connection) appendAcknowledgements(now time.Time, p []byte) []byte {
 	total := (int(c.sendQueue.mss()) - len(p) - 16) / 8
-	if ranges, maxSequenceID, delay := c.ack.flush(now, total, true); len(ranges) > 0 {
-		return append(p, frame.PackSingle(&frame.Acknowledgement{Delay: delay, Max: maxSequenceID, Ranges: ranges})...)
+	if ranges, maxSequenceID, delay := c.ack.flush(now, c.acknowledgement.Ranges, total, true); len(ranges) > 0 {
+		c.acknowledgement = frame.Acknowledgement{Delay: delay, Max: maxSequenceID, Ranges: ranges}
+		return frame.Append(p, &c.acknowledgement)
 	}
 	return p
 }
 
 func (c *connection) acknowledge(now time.Time) (err error) {
 	for {
-		ranges, maxSequenceID, delay := c.ack.flush(now, protocol.MaxAckRanges, false)
+		ranges, maxSequenceID, delay := c.ack.flush(now, c.acknowledgement.Ranges, protocol.MaxAckRanges, false)
 		if len(ranges) == 0 {
 			break
 		}
 
-		if err := c.writeControl(&frame.Acknowledgement{Delay: delay, Max: maxSequenceID, Ranges: ranges}, false); err != nil {
+		c.acknowledgement = frame.Acknowledgement{Delay: delay, Max: maxSequenceID, Ranges: ranges}
+		if err := c.writeControl(&c.acknowledgement, false); err != nil {
 			return err
 		}
 	}
@@ -358,76 +665,210 @@ func (c *connection) writeControl(fr frame.Frame, needsAck bool) (err error) {
 	if needsAck {
 		sequenceID = c.sequenceID.Add(1)
 	}
+	return c.writeSequenced(sequenceID, fr)
+}
 
-	pk := frame.Pack(protocol.ConnectionID(c.connectionID.Load()), sequenceID, frame.PackSingle(fr))
-	if _, err := c.writeDatagram(pk); err != nil {
+func (c *connection) writeSequenced(sequenceID uint32, fr frame.Frame) (err error) {
+	pk := c.newPacket(sequenceID)
+	pk.b = frame.Append(pk.b, fr)
+	return c.writePacket(sequenceID, pk)
+}
+
+func (c *connection) writePacket(sequenceID uint32, pk *packet) (err error) {
+	if _, err := c.writeDatagram(pk.b); errors.Is(err, errAmplificationLimit) && sequenceID != 0 {
+		c.deferPacket(deferredPacket{sequenceID: sequenceID, pk: pk})
+		return nil
+	} else if errors.Is(err, errAmplificationLimit) {
+		pk.release()
+		return nil
+	} else if err != nil {
+		pk.release()
 		return err
 	}
 
-	if needsAck {
-		c.retransmission.add(time.Now(), sequenceID, pk)
+	if sequenceID != 0 {
+		c.retransmission.add(c.clock.Now(), sequenceID, pk)
+	} else {
+		pk.release()
 	}
 	return
 }
 
+func (c *connection) newPacket(sequenceID uint32) *packet {
+	pk := c.sendQueue.pool.get()
+	pk.b = frame.AppendHeader(pk.b, c.destinationID(), sequenceID)
+	return pk
+}
+
 func (c *connection) writeDatagram(p []byte) (int, error) {
 	select {
 	case <-c.ctx.Done():
 		return 0, context.Cause(c.ctx)
 	default:
 	}
-	return c.conn.Write(p, c.peerAddr)
+
+	if !c.validated.Load() {
+		if c.bytesSent.Load()+uint64(len(p)) > amplificationFactor*c.bytesReceived.Load() {
+			c.logger.Log("amplification_limit", "len", len(p), "sent", c.bytesSent.Load(), "received", c.bytesReceived.Load())
+			return 0, errAmplificationLimit
+		}
+		c.bytesSent.Add(uint64(len(p)))
+	}
+	return c.conn.Load().Write(p, c.RemoteAddr())
+}
+
+func (c *connection) transportParameters() frame.TransportParameters {
+	return frame.TransportParameters{
+		IdleTimeout:         uint64(c.config.IdleTimeout.Milliseconds()),
+		MaxStreams:          uint64(c.config.MaxStreams),
+		StreamReceiveWindow: uint64(c.config.StreamReceiveWindow),
+		MaxDatagramSize:     uint64(c.config.MaxUDPPayloadSize),
+	}
+}
+
+func (c *connection) negotiate(now time.Time, parameters frame.TransportParameters) bool {
+	if !c.peerParameters.CompareAndSwap(nil, &parameters) {
+		c.logger.Log("transport_parameters_duplicate")
+		return false
+	}
+	c.negotiateIdleTimeout(now, time.Duration(parameters.IdleTimeout)*time.Millisecond)
+	if parameters.MaxDatagramSize >= protocol.MinUDPPayloadSize {
+		c.discovery.setCeiling(parameters.MaxDatagramSize - protocol.PacketOverhead)
+	}
+	c.logger.Log("transport_parameters", "maxStreams", parameters.MaxStreams, "streamReceiveWindow", parameters.StreamReceiveWindow, "maxDatagramSize", parameters.MaxDatagramSize)
+	return true
+}
+
+func (c *connection) resetIdle(now time.Time) {
+	if c.closing == nil {
+		c.idle = now.Add(c.idleTimeout)
+	}
+}
+
+func (c *connection) negotiateIdleTimeout(now time.Time, peerIdleTimeout time.Duration) {
+	if peerIdleTimeout > 0 && peerIdleTimeout < c.idleTimeout {
+		c.idleTimeout = peerIdleTimeout
+		c.idle = now.Add(c.idleTimeout)
+	}
+	c.setKeepAlive(now, c.keepAlivePeriod)
+	c.logger.Log("idle_timeout_negotiated", "timeout", c.idleTimeout, "keepAlive", c.keepAlivePeriod)
+}
+
+func (c *connection) setKeepAlive(now time.Time, period time.Duration) {
+	if period <= 0 {
+		return
+	}
+	c.keepAlivePeriod = min(period, c.idleTimeout/2)
+	c.keepAlive = now.Add(c.keepAlivePeriod)
+}
+
+func (c *connection) sendGoAway() error {
+	c.markGoingAway()
+	c.logger.Log("go_away")
+	return c.writeControl(&frame.GoAway{}, true)
+}
+
+func (c *connection) markGoingAway() {
+	c.goAwayOnce.Do(func() {
+		close(c.goAway)
+	})
+}
+
+func (c *connection) goingAway() bool {
+	select {
+	case <-c.goAway:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *connection) drained() bool {
+	return c.streams.len() == 0 && !c.sendQueue.available() && c.retransmission.len() == 0 && !c.hasDeferred()
+}
+
+func (c *connection) onPingAck(sequenceID uint32, rtt time.Duration) {
+	c.pingsMu.Lock()
+	if ch, ok := c.pings[sequenceID]; ok {
+		ch <- max(rtt, 0)
+		delete(c.pings, sequenceID)
+	}
+	c.pingsMu.Unlock()
 }
 
 func (c *connection) createStream(streamID protocol.StreamID) (*Stream, error) {
+	if c.sendQueue.stopped() {
+		return nil, ErrConnectionClosing
+	}
+
 	if c.streams.get(streamID) != nil {
 		c.logger.Log("duplicate_stream", "streamID", streamID)
 		return nil, fmt.Errorf("stream %v already exists", streamID)
 	}
-	stream := newStream(streamID, c.ctx, c.sendQueue, c.wake, func() {
-		_ = c.writeControl(&frame.StreamClose{StreamID: streamID}, true)
+	sendWindow := c.config.StreamSendWindow
+	if parameters := c.peerParameters.Load(); parameters != nil && parameters.StreamReceiveWindow > 0 && parameters.StreamReceiveWindow < uint64(sendWindow) {
+		sendWindow = int(parameters.StreamReceiveWindow)
+	}
+
+	var stream *Stream
+	stream = newStream(streamID, c.ctx, c.clock, c.config.StreamReceiveWindow, sendWindow, c.sendQueue, c.wake, func() {
+		c.sendQueue.add(stream.queue, &frame.StreamClose{StreamID: streamID})
+		c.wake()
 		c.streams.remove(streamID)
 	}, c.logger)
 	c.streams.add(stream)
 	return stream, nil
 }
 
-func (c *connection) close(message string) (err error) {
+func (c *connection) deliver(pk *receivedPacket) {
+	select {
+	case c.packets <- pk:
+	case <-c.done:
+		pk.release()
+	}
+}
+
+func (c *connection) destinationID() protocol.ConnectionID {
+	if c.perspective == log.PerspectiveServer {
+		return c.peerID
+	}
+	return protocol.ConnectionID(c.connectionID.Load())
+}
+
+func (c *connection) shutdown(message string) {
 	c.once.Do(func() {
 		for _, stream := range c.streams.all() {
-			_ = stream.internalClose(fmt.Sprintf("closed by connection: %s", message))
+			_ = stream.internalClose(fmt.Errorf("closed by connection: %s", message))
 		}
 		c.cancelFunc(errors.New(message))
-		c.logger.Log("connection_close")
-		c.logger.Close()
-		_ = c.conn.Close()
+		close(c.closed)
 	})
-	return
 }
 
 func (c *connection) cleanup() {
-	<-c.ctx.Done()
+	c.deferredMu.Lock()
+	for _, d := range c.deferred {
+		d.pk.release()
+	}
+	c.deferred = nil
+	c.deferredMu.Unlock()
 	c.retransmission.clear()
 	c.sendQueue.clear()
 	c.handler = nil
 	c.discovery.mtuIncrease = nil
 	clear(c.receiveQueue.queue)
-	close(c.packets)
-	close(c.notify)
+	c.logger.Log("connection_close")
+	c.logger.Close()
+	_ = c.conn.Load().Close()
+	close(c.done)
 }
 
-func firstTime(idle, ack, retransmission, pacing time.Time) time.Time {
+func firstTime(idle time.Time, deadlines ...time.Time) time.Time {
 	deadline := idle
-	if !ack.IsZero() && ack.Before(deadline) {
-		deadline = ack
-	}
-
-	if !retransmission.IsZero() && retransmission.Before(deadline) {
-		deadline = retransmission
-	}
-
-	if !pacing.IsZero() && pacing.Before(deadline) {
-		deadline = pacing
+	for _, t := range deadlines {
+		if !t.IsZero() && t.Before(deadline) {
+			deadline = t
+		}
 	}
 	return deadline
 }
@@ -0,0 +1,540 @@
+package spectral
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"math"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cooldogedev/spectral/internal/clock"
+	"github.com/cooldogedev/spectral/internal/congestion"
+	"github.com/cooldogedev/spectral/internal/frame"
+	"github.com/cooldogedev/spectral/internal/log"
+	"github.com/cooldogedev/spectral/internal/protocol"
+	"github.com/cooldogedev/spectral/spectraltest"
+)
+
+type pipePair struct {
+	listener     *Listener
+	server       Connection
+	client       Connection
+	serverPacket *spectraltest.Conn
+	clientPacket *spectraltest.Conn
+}
+
+func newPipePair(t *testing.T, link spectraltest.LinkConfig, serverConfig, clientConfig *Config) *pipePair {
+	t.Helper()
+	clientPacket, serverPacket := spectraltest.Pipe(link)
+	listener, err := ListenPacketConn(serverPacket, serverConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	client, err := DialPacketConn(ctx, clientPacket, serverPacket.LocalAddr(), clientConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = client.CloseWithError(0, "") })
+
+	server, err := listener.Accept(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &pipePair{listener, server, client, serverPacket, clientPacket}
+}
+
+func (p *pipePair) streams(t *testing.T) (server *Stream, client *Stream) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	accepted := make(chan *Stream, 1)
+	go func() {
+		stream, _ := p.server.AcceptStream(ctx)
+		accepted <- stream
+	}()
+
+	client, err := p.client.OpenStream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if server = <-accepted; server == nil {
+		t.Fatal("failed to accept stream")
+	}
+	return
+}
+
+func transfer(t *testing.T, link spectraltest.LinkConfig, size int) {
+	t.Helper()
+	pair := newPipePair(t, link, nil, nil)
+	server, client := pair.streams(t)
+	payload := make([]byte, size)
+	_, _ = rand.Read(payload)
+	if _, err := client.Write(payload); err != nil {
+		t.Fatal(err)
+	}
+
+	received := make([]byte, size)
+	done := make(chan error, 1)
+	go func() {
+		_, err := io.ReadFull(server, received)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second * 30):
+		t.Fatal("transfer timed out")
+	}
+
+	if !bytes.Equal(payload, received) {
+		t.Fatal("received payload does not match sent payload")
+	}
+}
+
+func TestConnectionTransfer(t *testing.T) {
+	transfer(t, spectraltest.LinkConfig{Latency: time.Millisecond}, 1024*1024)
+}
+
+func TestConnectionLossyTransfer(t *testing.T) {
+	transfer(t, spectraltest.LinkConfig{
+		Latency:   time.Millisecond * 5,
+		Jitter:    time.Millisecond * 2,
+		Loss:      0.02,
+		Reorder:   0.05,
+		Duplicate: 0.02,
+		Seed:      1,
+	}, 512*1024)
+}
+
+func TestConnectionBandwidthLimitedTransfer(t *testing.T) {
+	transfer(t, spectraltest.LinkConfig{Latency: time.Millisecond * 10, Bandwidth: 2 * 1024 * 1024, QueueLength: 64}, 512*1024)
+}
+
+func TestConnectionMTUDiscovery(t *testing.T) {
+	const mtu = 1300
+	pair := newPipePair(t, spectraltest.LinkConfig{Latency: time.Millisecond, MTU: mtu}, nil, nil)
+	_, client := pair.streams(t)
+	_, _ = client.Write(make([]byte, 256*1024))
+	c := pair.client.(*ClientConnection)
+	deadline := time.Now().Add(time.Second * 5)
+	for time.Now().Before(deadline) {
+		mss := c.sendQueue.mss()
+		if mss > mtu-20-mtuDiff && mss <= mtu-20 {
+			return
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	t.Fatalf("mss %v did not converge below link mtu %v", c.sendQueue.mss(), mtu)
+}
+
+func TestConnectionCloseFlushesData(t *testing.T) {
+	pair := newPipePair(t, spectraltest.LinkConfig{Latency: time.Millisecond * 5}, nil, nil)
+	server, client := pair.streams(t)
+	payload := make([]byte, 256*1024)
+	_, _ = rand.Read(payload)
+	_, _ = server.Write(payload)
+	if err := pair.server.CloseWithError(0, "done"); err != nil {
+		t.Fatal(err)
+	}
+
+	received, _ := io.ReadAll(client)
+	if !bytes.Equal(payload, received) {
+		t.Fatalf("received %v of %v bytes before close", len(received), len(payload))
+	}
+
+	select {
+	case <-pair.client.Context().Done():
+	case <-time.After(time.Second):
+		t.Fatal("client was not closed by peer")
+	}
+}
+
+func TestConnectionCloseWithActiveWriter(t *testing.T) {
+	pair := newPipePair(t, spectraltest.LinkConfig{Latency: time.Millisecond * 5}, nil, nil)
+	server, client := pair.streams(t)
+	go func() { _, _ = io.Copy(io.Discard, server) }()
+
+	written := make(chan error, 1)
+	go func() {
+		payload := make([]byte, 512)
+		for {
+			if _, err := client.Write(payload); err != nil {
+				written <- err
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	time.Sleep(time.Millisecond * 50)
+
+	closed := make(chan error, 1)
+	go func() { closed <- pair.client.CloseWithError(0, "done") }()
+	select {
+	case <-closed:
+	case <-time.After(time.Second * 5):
+		t.Fatal("close did not return while a stream kept writing")
+	}
+
+	if err := <-written; !errors.Is(err, ErrConnectionClosing) {
+		t.Fatalf("expected the writer to fail once closing started, got %v", err)
+	}
+
+	if _, err := pair.client.OpenStream(context.Background()); !errors.Is(err, ErrConnectionClosing) {
+		t.Fatalf("expected opening a stream while closing to fail, got %v", err)
+	}
+}
+
+func TestConnectionIdleTimeout(t *testing.T) {
+	pair := newPipePair(t, spectraltest.LinkConfig{}, &Config{IdleTimeout: time.Millisecond * 200}, nil)
+	_ = pair.clientPacket.Close()
+	select {
+	case <-pair.server.Context().Done():
+	case <-time.After(time.Second * 2):
+		t.Fatal("server connection did not time out")
+	}
+}
+
+func TestConnectionKeepAlive(t *testing.T) {
+	config := &Config{IdleTimeout: time.Millisecond * 300, KeepAlivePeriod: time.Millisecond * 50}
+	pair := newPipePair(t, spectraltest.LinkConfig{}, config, config)
+	time.Sleep(time.Second)
+	if err := pair.client.Context().Err(); err != nil {
+		t.Fatalf("connection closed despite keep-alive: %v", context.Cause(pair.client.Context()))
+	}
+}
+
+func TestConnectionPing(t *testing.T) {
+	pair := newPipePair(t, spectraltest.LinkConfig{Latency: time.Millisecond * 20}, nil, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
+	defer cancel()
+	rtt, err := pair.client.Ping(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rtt < time.Millisecond*40 {
+		t.Fatalf("measured rtt %v below link round trip of 40ms", rtt)
+	}
+}
+
+func TestConnectionRefused(t *testing.T) {
+	clientPacket, serverPacket := spectraltest.Pipe(spectraltest.LinkConfig{})
+	listener, err := ListenPacketConn(serverPacket, &Config{
+		AdmitConnection: func(_ net.Addr, _ HandshakeParameters) error { return errors.New("not today") },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
+	defer cancel()
+	_, err = DialPacketConn(ctx, clientPacket, serverPacket.LocalAddr(), nil)
+	var refused *ConnectionRefusedError
+	if !errors.As(err, &refused) || refused.Reason != "not today" {
+		t.Fatalf("expected refusal, got %v", err)
+	}
+}
+
+func TestConnectionAddressValidation(t *testing.T) {
+	pair := newPipePair(t, spectraltest.LinkConfig{}, &Config{RequireAddressValidation: true}, nil)
+	server, client := pair.streams(t)
+	_, _ = client.Write([]byte("hello"))
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(server, buf); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConnectionGoAway(t *testing.T) {
+	pair := newPipePair(t, spectraltest.LinkConfig{}, nil, nil)
+	_, _ = pair.streams(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	go func() { _ = pair.listener.Shutdown(ctx) }()
+
+	select {
+	case <-pair.client.GoingAway():
+	case <-ctx.Done():
+		t.Fatal("client did not receive goaway")
+	}
+
+	if _, err := pair.client.OpenStream(ctx); !errors.Is(err, ErrGoAway) {
+		t.Fatalf("expected ErrGoAway, got %v", err)
+	}
+}
+
+type discardPacketConn struct {
+	closed chan struct{}
+}
+
+func (d *discardPacketConn) ReadFrom([]byte) (int, net.Addr, error) {
+	<-d.closed
+	return 0, nil, net.ErrClosed
+}
+
+func (d *discardPacketConn) WriteTo(p []byte, _ net.Addr) (int, error) { return len(p), nil }
+
+func (d *discardPacketConn) Close() error {
+	close(d.closed)
+	return nil
+}
+
+func (d *discardPacketConn) LocalAddr() net.Addr              { return spectraltest.Addr("discard") }
+func (d *discardPacketConn) SetDeadline(time.Time) error      { return nil }
+func (d *discardPacketConn) SetReadDeadline(time.Time) error  { return nil }
+func (d *discardPacketConn) SetWriteDeadline(time.Time) error { return nil }
+
+func newSendBenchmark(tb testing.TB) (*connection, *Stream, time.Time) {
+	tb.Helper()
+	conn, err := newUDPConn(&discardPacketConn{closed: make(chan struct{})}, false, protocol.MaxUDPPayloadSize)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { _ = conn.Close() })
+
+	now := time.Now()
+	ctx, cancel := context.WithCancelCause(context.Background())
+	tb.Cleanup(func() { cancel(nil) })
+	c := &connection{
+		clock:          clock.Wall,
+		perspective:    log.PerspectiveClient,
+		ctx:            ctx,
+		cancelFunc:     cancel,
+		sender:         congestion.NewSender(log.NopLogger{}, now, protocol.MinPacketSize),
+		ack:            newAckQueue(),
+		retransmission: newRetransmissionQueue(),
+		sendQueue:      newSendQueue(newPacketPool(protocol.MaxPacketSize)),
+		rtt:            congestion.NewRTT(),
+		logger:         log.NopLogger{},
+	}
+	c.rtt.Add(time.Millisecond, 0)
+	c.conn.Store(conn)
+	c.peerAddr.Store(net.Addr(spectraltest.Addr("peer")))
+	c.validated.Store(true)
+	return c, newStream(1, ctx, clock.Wall, 1024, defaultStreamSendWindow, c.sendQueue, func() {}, func() {}, log.NopLogger{}), now
+}
+
+func receiveFrames(t *testing.T, c *connection, now time.Time, addr net.Addr, sequenceID uint32, frames []byte) {
+	t.Helper()
+	if c.receiveQueue == nil {
+		c.receiveQueue = newReceiveQueue()
+	}
+	c.handler = func(frame.Frame) error { return nil }
+	dgram := newDatagramPool(protocol.MaxUDPPayloadSize).get()
+	dgram.b = frame.Pack(0, sequenceID, frames)
+	dgram.peerAddr = addr
+	if err := c.receive(now, newReceivedPacket(dgram, sequenceID, now)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConnectionDropsMalformedPacketWithoutAck(t *testing.T) {
+	c, _, now := newSendBenchmark(t)
+	valid := frame.PackSingle(&frame.Ping{})
+	malformed := frame.PackSingle(&frame.StreamClose{StreamID: 1})
+	receiveFrames(t, c, now, c.RemoteAddr(), 1, append(valid, malformed[:len(malformed)-1]...))
+	if c.receiveQueue.exists(1) || len(c.ack.ranges) > 0 {
+		t.Fatal("expected a packet with a malformed frame to be dropped without an acknowledgement")
+	}
+
+	receiveFrames(t, c, now, c.RemoteAddr(), 1, valid)
+	if !c.receiveQueue.exists(1) {
+		t.Fatal("expected the retransmitted packet to be accepted")
+	}
+}
+
+func TestConnectionDropsStreamDataOutsideWindowWithoutAck(t *testing.T) {
+	c, stream, now := newSendBenchmark(t)
+	c.streams = newStreamMap()
+	c.streams.add(stream)
+	receiveFrames(t, c, now, c.RemoteAddr(), 1, frame.PackSingle(&frame.StreamData{StreamID: stream.streamID, SequenceID: math.MaxUint32, Payload: []byte("x")}))
+	if c.receiveQueue.exists(1) || len(c.ack.ranges) > 0 || len(stream.frame.segments) > 0 {
+		t.Fatal("expected stream data outside the receive window to be dropped without an acknowledgement")
+	}
+
+	receiveFrames(t, c, now, c.RemoteAddr(), 1, frame.PackSingle(&frame.StreamData{StreamID: stream.streamID, SequenceID: 1, Payload: []byte("x")}))
+	if !c.receiveQueue.exists(1) || len(stream.frame.segments) != 1 {
+		t.Fatal("expected stream data inside the receive window to be accepted")
+	}
+}
+
+func TestConnectionAmplificationLimitDefersSends(t *testing.T) {
+	c, stream, now := newSendBenchmark(t)
+	c.validated.Store(false)
+	c.bytesReceived.Store(100)
+	available := c.sender.Available()
+	if _, err := stream.Write(make([]byte, 1000)); err != nil {
+		t.Fatal(err)
+	}
+
+	if wouldBlock, err := c.transmit(now.Add(time.Second)); err != nil || !wouldBlock || !c.hasDeferred() {
+		t.Fatalf("expected the amplification limit to block transmission, got %v", err)
+	}
+
+	if err := c.writeControl(&frame.Padding{Length: 400}, true); err != nil {
+		t.Fatal(err)
+	}
+
+	if c.bytesSent.Load() != 0 || c.retransmission.len() != 0 || c.sender.Available() != available {
+		t.Fatalf("expected blocked packets to be neither sent nor in flight, sent %v bytes with %v awaiting acks", c.bytesSent.Load(), c.retransmission.len())
+	}
+
+	c.bytesReceived.Store(10000)
+	if err := c.sendDeferred(now); err != nil {
+		t.Fatal(err)
+	}
+
+	if c.hasDeferred() || c.retransmission.len() != 2 || c.sender.Available() >= available {
+		t.Fatalf("expected deferred packets to be sent once the limit lifted, %v awaiting acks", c.retransmission.len())
+	}
+}
+
+func BenchmarkConnectionSend(b *testing.B) {
+	c, stream, now := newSendBenchmark(b)
+	payload := make([]byte, 1024)
+	b.SetBytes(int64(len(payload)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := range b.N {
+		now = now.Add(time.Millisecond)
+		c.ack.add(now, uint32(i+1))
+		_, _ = stream.Write(payload)
+		if _, err := c.transmit(now); err != nil {
+			b.Fatal(err)
+		}
+
+		if entry, ok := c.retransmission.remove(c.sequenceID.Load()); ok {
+			c.sender.OnAck(now, entry.sent, c.rtt, entry.size)
+		}
+	}
+}
+
+func BenchmarkConnectionSendControl(b *testing.B) {
+	c, _, now := newSendBenchmark(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := range b.N {
+		c.ack.add(now, uint32(i+1))
+		c.ack.expedite(now)
+		if err := c.acknowledge(now); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkConnectionAck(b *testing.B) {
+	const window = 10_000
+	c, _, now := newSendBenchmark(b)
+	addr := c.RemoteAddr()
+	ack := &frame.Acknowledgement{Ranges: make([]frame.AcknowledgementRange, 0, window/100)}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		first := c.sequenceID.Load() + 1
+		for range window {
+			sequenceID := c.sequenceID.Add(1)
+			pk := c.newPacket(sequenceID)
+			pk.b = frame.Append(pk.b, &frame.Ping{})
+			c.retransmission.add(now, sequenceID, pk)
+		}
+
+		now = now.Add(time.Millisecond * 10)
+		ack.Max = first + window - 1
+		ack.Ranges = ack.Ranges[:0]
+		for i := first; i < first+window; i += 100 {
+			ack.Ranges = append(ack.Ranges, frame.AcknowledgementRange{i, i + 98})
+		}
+		if err := c.handle(now, addr, ack); err != nil {
+			b.Fatal(err)
+		}
+
+		ack.Ranges = append(ack.Ranges[:0], frame.AcknowledgementRange{first, math.MaxUint32})
+		if err := c.handle(now, addr, ack); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestDialRejectsVersionMismatch(t *testing.T) {
+	clientPacket, serverPacket := spectraltest.Pipe(spectraltest.LinkConfig{})
+	defer serverPacket.Close()
+	go func() {
+		var reader frame.Reader
+		buf := make([]byte, protocol.MaxUDPPayloadSize)
+		n, addr, err := serverPacket.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+
+		connectionID, _, _, err := reader.Unpack(buf[:n])
+		if err != nil {
+			return
+		}
+		response := &frame.ConnectionResponse{ConnectionID: 1, Response: frame.ConnectionResponseSuccess, Version: protocol.Version + 1}
+		_, _ = serverPacket.WriteTo(frame.Pack(connectionID, 0, frame.PackSingle(response)), addr)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	_, err := DialPacketConn(ctx, clientPacket, serverPacket.LocalAddr(), nil)
+	var refused *ConnectionRefusedError
+	if !errors.As(err, &refused) || !strings.Contains(refused.Reason, "unsupported protocol version") {
+		t.Fatalf("expected a version rejection, got %v", err)
+	}
+}
+
+func TestDialPacketConnKeepsConnOnError(t *testing.T) {
+	clientPacket, serverPacket := spectraltest.Pipe(spectraltest.LinkConfig{})
+	defer clientPacket.Close()
+	defer serverPacket.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	if _, err := DialPacketConn(ctx, clientPacket, serverPacket.LocalAddr(), nil); err == nil {
+		t.Fatal("expected the dial to time out")
+	}
+
+	if _, err := serverPacket.WriteTo([]byte("still open"), clientPacket.LocalAddr()); err != nil {
+		t.Fatal(err)
+	}
+
+	_ = clientPacket.SetReadDeadline(time.Now().Add(time.Second * 5))
+	buf := make([]byte, 64)
+	n, _, err := clientPacket.ReadFrom(buf)
+	if err != nil || string(buf[:n]) != "still open" {
+		t.Fatalf("expected the caller's conn to stay usable, got %q, %v", buf[:n], err)
+	}
+}
+
+func TestConnectionPacketPoolFollowsConfig(t *testing.T) {
+	pair := newPipePair(t, spectraltest.LinkConfig{}, nil, &Config{MaxUDPPayloadSize: 9000})
+	if size := pair.client.(*ClientConnection).sendQueue.pool.size; size != protocol.PacketHeaderSize+9000-protocol.PacketOverhead {
+		t.Fatalf("expected packet buffers sized for a 9000 byte payload, got %v", size)
+	}
+
+	if size := pair.server.(*ServerConnection).sendQueue.pool.size; size != protocol.PacketHeaderSize+protocol.MaxPacketSize {
+		t.Fatalf("expected default packet buffers on the server, got %v", size)
+	}
+}
+
+func TestConnectionPeerStreamReceiveWindow(t *testing.T) {
+	pair := newPipePair(t, spectraltest.LinkConfig{}, &Config{StreamReceiveWindow: 4096}, nil)
+	_, client := pair.streams(t)
+	if n, err := client.TryWrite(make([]byte, 8192)); err != nil || n != 4096 {
+		t.Fatalf("expected the peer's receive window to cap buffered data at 4096 bytes, got %v, %v", n, err)
+	}
+}
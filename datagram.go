@@ -3,29 +3,35 @@ package spectral
 import (
 	"net"
 	"sync"
-
-	"github.com/cooldogedev/spectral/internal/protocol"
 )
 
-var datagramPool = sync.Pool{
-	New: func() any {
-		return &datagram{b: make([]byte, protocol.MaxUDPPayloadSize)}
-	},
+type datagramPool struct {
+	size int
+	pool sync.Pool
 }
 
-type datagram struct {
-	b        []byte
-	peerAddr *net.UDPAddr
+func newDatagramPool(size int) *datagramPool {
+	p := &datagramPool{size: size}
+	p.pool.New = func() any {
+		return &datagram{b: make([]byte, size)}
+	}
+	return p
 }
 
-func newDatagram() *datagram {
-	dgram := datagramPool.Get().(*datagram)
-	*dgram = datagram{b: dgram.b[:cap(dgram.b)]}
+func (p *datagramPool) get() *datagram {
+	dgram := p.pool.Get().(*datagram)
+	*dgram = datagram{b: dgram.b[:cap(dgram.b)], pool: p}
 	return dgram
 }
 
+type datagram struct {
+	b        []byte
+	peerAddr net.Addr
+	pool     *datagramPool
+}
+
 func (d *datagram) reset() {
-	if cap(d.b) == protocol.MaxUDPPayloadSize {
-		datagramPool.Put(d)
+	if cap(d.b) == d.pool.size {
+		d.pool.pool.Put(d)
 	}
 }
@@ -0,0 +1,32 @@
+package spectral
+
+import (
+	"fmt"
+	"runtime/debug"
+
+	"github.com/cooldogedev/spectral/internal/frame"
+	"github.com/cooldogedev/spectral/internal/log"
+	"github.com/cooldogedev/spectral/internal/protocol"
+)
+
+func unpack(reader *frame.Reader, p []byte, logger log.Logger) (connectionID protocol.ConnectionID, sequenceID uint32, frameID uint32, err error) {
+	defer recoverDecode(logger, &err)
+	return reader.Unpack(p)
+}
+
+func request(reader *frame.Reader, p []byte, logger log.Logger) (fr *frame.ConnectionRequest, err error) {
+	defer recoverDecode(logger, &err)
+	return reader.Request(p)
+}
+
+func next(reader *frame.Reader, p []byte, logger log.Logger) (fr frame.Frame, n int, err error) {
+	defer recoverDecode(logger, &err)
+	return reader.Next(p)
+}
+
+func recoverDecode(logger log.Logger, err *error) {
+	if v := recover(); v != nil {
+		logger.Log("decode_panic", "panic", v, "stack", string(debug.Stack()))
+		*err = fmt.Errorf("decode panic: %v", v)
+	}
+}
@@ -2,7 +2,6 @@ package spectral
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"net"
 	"time"
@@ -11,6 +10,10 @@ import (
 )
 
 func Dial(ctx context.Context, address string) (Connection, error) {
+	return DialConfig(ctx, address, nil)
+}
+
+func DialConfig(ctx context.Context, address string, config *Config) (Connection, error) {
 	addr, err := net.ResolveUDPAddr("udp", address)
 	if err != nil {
 		return nil, err
@@ -21,35 +24,54 @@ func Dial(ctx context.Context, address string) (Connection, error) {
 		return nil, err
 	}
 
-	uConn, err := newUDPConn(conn, false)
+	c, err := DialPacketConn(ctx, conn, addr, config)
 	if err != nil {
 		_ = conn.Close()
 		return nil, err
 	}
+	return c, nil
+}
 
-	c := newClientConnection(uConn, addr, context.Background())
-	c.logger.Log("connection_request", "addr", address)
-	if err := c.writeControl(&frame.ConnectionRequest{}, true); err != nil {
-		_ = c.CloseWithError(frame.ConnectionCloseInternal, "failed to send connection request")
+func DialPacketConn(ctx context.Context, conn net.PacketConn, addr net.Addr, config *Config) (Connection, error) {
+	config, err := populateConfig(config)
+	if err != nil {
 		return nil, err
 	}
 
-	go uConn.Read(func(dgram *datagram) (err error) {
-		defer dgram.reset()
-		_, sequenceID, frames, err := frame.Unpack(dgram.b)
-		if err != nil {
-			c.logger.Log("unpack_err", "err", err.Error())
-			return err
-		}
+	uConn, err := newUDPConn(conn, true, config.MaxUDPPayloadSize)
+	if err != nil {
+		return nil, err
+	}
 
-		select {
-		case <-c.ctx.Done():
-			return context.Cause(c.ctx)
-		default:
-			c.packets <- &receivedPacket{sequenceID, frames, time.Now()}
-			return
-		}
+	c := newClientConnection(uConn, addr, -1, context.Background(), config)
+	started, read := false, make(chan struct{})
+	dialed, err := handshake(ctx, c, func() {
+		started = true
+		go func() {
+			defer close(read)
+			c.read(uConn)
+		}()
 	})
+	if err != nil {
+		if started {
+			_ = conn.SetReadDeadline(time.Unix(1, 0))
+			<-read
+			_ = conn.SetReadDeadline(time.Time{})
+		}
+		return nil, err
+	}
+	uConn.shared.Store(false)
+	return dialed, nil
+}
+
+func handshake(ctx context.Context, c *ClientConnection, start func()) (Connection, error) {
+	c.logger.Log("connection_request", "addr", c.RemoteAddr().String())
+	if err := c.requestConnection(nil); err != nil {
+		_ = c.CloseWithError(frame.ConnectionCloseInternal, "failed to send connection request")
+		return nil, err
+	}
+
+	start()
 	select {
 	case <-ctx.Done():
 		c.logger.Log("connection_request_timeout")
@@ -57,9 +79,9 @@ func Dial(ctx context.Context, address string) (Connection, error) {
 		return nil, context.Cause(ctx)
 	case response := <-c.response:
 		if response.Response == frame.ConnectionResponseFailed {
-			c.logger.Log("connection_request_fail")
+			c.logger.Log("connection_request_fail", "reason", response.Reason)
 			_ = c.CloseWithError(frame.ConnectionCloseInternal, "failed to open connection")
-			return nil, errors.New("failed to open connection")
+			return nil, &ConnectionRefusedError{Reason: response.Reason}
 		}
 		c.connectionID.Store(int64(response.ConnectionID))
 		c.logger.SetConnectionID(response.ConnectionID)
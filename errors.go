@@ -0,0 +1,17 @@
+package spectral
+
+import "errors"
+
+var ErrGoAway = errors.New("connection is going away")
+
+var ErrConnectionClosing = errors.New("connection is closing")
+
+var errStreamClosedByPeer = errors.New("closed by peer")
+
+type ConnectionRefusedError struct {
+	Reason string
+}
+
+func (e *ConnectionRefusedError) Error() string {
+	return "connection refused: " + e.Reason
+}
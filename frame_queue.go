@@ -1,48 +1,51 @@
 package spectral
 
-import "sort"
+type frameQueue struct {
+	segments map[uint32][]byte
+	expected uint32
+	size     int
+	window   int
+}
 
-type frameEntry struct {
-	sequenceID uint32
-	payload    []byte
+func newFrameQueue(window int) *frameQueue {
+	return &frameQueue{window: window}
 }
 
-type frameQueue struct {
-	queue    []*frameEntry
-	expected uint32
+func (f *frameQueue) top() []byte {
+	return f.segments[f.expected]
 }
 
-func newFrameQueue() *frameQueue {
-	return &frameQueue{}
+func (f *frameQueue) accepts(sequenceID uint32, n int) bool {
+	return sequenceID < f.expected || f.inWindow(sequenceID) && f.size+n <= f.window
 }
 
-func (f *frameQueue) top() *frameEntry {
-	if len(f.queue) > 0 && f.queue[0].sequenceID == f.expected {
-		return f.queue[0]
-	}
-	return nil
+func (f *frameQueue) inWindow(sequenceID uint32) bool {
+	return sequenceID >= f.expected && sequenceID-f.expected < uint32(f.window)
 }
 
 func (f *frameQueue) enqueue(sequenceID uint32, p []byte) {
-	f.queue = append(f.queue, &frameEntry{sequenceID: sequenceID, payload: append([]byte(nil), p...)})
-	sort.Slice(f.queue, func(i, j int) bool { return f.queue[i].sequenceID < f.queue[j].sequenceID })
+	if !f.inWindow(sequenceID) {
+		return
+	}
+
+	if _, ok := f.segments[sequenceID]; ok {
+		return
+	}
+
+	if f.segments == nil {
+		f.segments = make(map[uint32][]byte)
+	}
+	f.segments[sequenceID] = append(make([]byte, 0, len(p)), p...)
+	f.size += len(p)
 }
 
 func (f *frameQueue) dequeue() {
-	entry := f.queue[0]
-	entry.payload = entry.payload[:0]
-	entry.payload = nil
-	f.queue[0] = nil
-	f.queue = f.queue[1:]
+	f.size -= len(f.segments[f.expected])
+	delete(f.segments, f.expected)
 	f.expected++
 }
 
 func (f *frameQueue) clear() {
-	for i, entry := range f.queue {
-		entry.payload = entry.payload[:0]
-		entry.payload = nil
-		f.queue[i] = nil
-	}
-	f.queue = f.queue[:0]
-	f.queue = nil
+	f.segments = nil
+	f.size = 0
 }
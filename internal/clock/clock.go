@@ -0,0 +1,34 @@
+package clock
+
+import "time"
+
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+}
+
+type Timer interface {
+	C() <-chan time.Time
+	Reset(d time.Duration) bool
+	Stop() bool
+}
+
+var Wall Clock = wall{}
+
+type wall struct{}
+
+func (wall) Now() time.Time {
+	return time.Now()
+}
+
+func (wall) NewTimer(d time.Duration) Timer {
+	return wallTimer{time.NewTimer(d)}
+}
+
+type wallTimer struct {
+	*time.Timer
+}
+
+func (t wallTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
@@ -1,10 +1,6 @@
 package congestion
 
-import (
-	"time"
-
-	"github.com/cooldogedev/spectral/internal/protocol"
-)
+import "time"
 
 type controller interface {
 	onAck(now, sent, recoveryStartTime time.Time, rtt *RTT, bytes, flight uint64)
@@ -22,13 +18,13 @@ func minimumWindow(mss uint64) uint64 {
 	return 2 * mss
 }
 
-func shouldIncreaseWindow(flight, window, ssthres uint64) bool {
+func shouldIncreaseWindow(flight, window, ssthres, mss uint64) bool {
 	if flight >= window {
 		return true
 	}
 	availableBytes := window - flight
 	slowStartLimited := ssthres > window && flight > window/2
-	return slowStartLimited || availableBytes <= 3*protocol.MaxPacketSize
+	return slowStartLimited || availableBytes <= 3*mss
 }
 
 func clamp(value, min, max uint64) uint64 {
@@ -0,0 +1,229 @@
+package congestion
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cooldogedev/spectral/internal/log"
+)
+
+const testMSS = 1200
+
+func TestRTTFirstSample(t *testing.T) {
+	r := NewRTT()
+	r.Add(time.Millisecond*40, 0)
+	if r.SRTT() != time.Millisecond*40 {
+		t.Fatalf("expected smoothed rtt of 40ms, got %v", r.SRTT())
+	}
+
+	if r.RTTVAR() != time.Millisecond*20 {
+		t.Fatalf("expected rtt variance of 20ms, got %v", r.RTTVAR())
+	}
+}
+
+func TestRTTSmoothing(t *testing.T) {
+	r := NewRTT()
+	r.Add(time.Millisecond*40, 0)
+	for range 100 {
+		r.Add(time.Millisecond*80, 0)
+	}
+
+	if srtt := r.SRTT(); srtt < time.Millisecond*79 || srtt > time.Millisecond*80 {
+		t.Fatalf("expected smoothed rtt to converge on 80ms, got %v", srtt)
+	}
+
+	if r.LatestRTT() != time.Millisecond*80 {
+		t.Fatalf("expected latest rtt of 80ms, got %v", r.LatestRTT())
+	}
+}
+
+func TestRTTAckDelay(t *testing.T) {
+	r := NewRTT()
+	r.Add(time.Millisecond*40, 0)
+	r.Add(time.Millisecond*60, time.Millisecond*20)
+	if r.SRTT() != time.Millisecond*40 {
+		t.Fatalf("expected ack delay to be subtracted, got %v", r.SRTT())
+	}
+}
+
+func TestRTTIgnoresInvalidSamples(t *testing.T) {
+	r := NewRTT()
+	r.Add(0, 0)
+	r.Add(-time.Second, 0)
+	if r.SRTT() != initialRTT {
+		t.Fatalf("expected initial rtt, got %v", r.SRTT())
+	}
+}
+
+func TestRenoSlowStart(t *testing.T) {
+	now := time.Now()
+	r := newReno(log.NopLogger{}, testMSS)
+	rtt := NewRTT()
+	initial := r.window()
+	r.onAck(now, now, now, rtt, testMSS, r.window())
+	if r.window() != initial+testMSS {
+		t.Fatalf("expected window to grow by one segment, got %v", r.window()-initial)
+	}
+}
+
+func TestRenoApplicationLimited(t *testing.T) {
+	now := time.Now()
+	r := newReno(log.NopLogger{}, testMSS)
+	initial := r.window()
+	r.onAck(now, now, now, NewRTT(), testMSS, 0)
+	if r.window() != initial {
+		t.Fatal("window grew while the sender was application limited")
+	}
+}
+
+func TestRenoCongestionEvent(t *testing.T) {
+	now := time.Now()
+	r := newReno(log.NopLogger{}, testMSS)
+	initial := r.window()
+	r.onCongestionEvent(now, now)
+	if r.window() != initial/2 {
+		t.Fatalf("expected window to halve, got %v from %v", r.window(), initial)
+	}
+
+	for range 10 {
+		r.onCongestionEvent(now, now)
+	}
+
+	if r.window() != minimumWindow(testMSS) {
+		t.Fatalf("expected window to stop at the minimum, got %v", r.window())
+	}
+}
+
+func TestRenoCongestionAvoidance(t *testing.T) {
+	now := time.Now()
+	r := newReno(log.NopLogger{}, testMSS)
+	r.onCongestionEvent(now, now)
+	window := r.window()
+	acked := uint64(0)
+	for acked < window*2 {
+		r.onAck(now, now, now, NewRTT(), testMSS, r.window())
+		acked += testMSS
+	}
+
+	if growth := r.window() - window; growth == 0 || growth > 2*testMSS {
+		t.Fatalf("expected linear growth of at most two segments, got %v", growth)
+	}
+}
+
+func TestCubicCongestionEvent(t *testing.T) {
+	now := time.Now()
+	c := newCubic(log.NopLogger{}, testMSS)
+	initial := c.window()
+	c.onCongestionEvent(now, now)
+	if expected := uint64(float64(initial) * cubicBeta); c.window() != expected {
+		t.Fatalf("expected window %v, got %v", expected, c.window())
+	}
+}
+
+func TestCubicRecoversTowardsMax(t *testing.T) {
+	now := time.Now()
+	c := newCubic(log.NopLogger{}, testMSS)
+	for range 50 {
+		c.onAck(now, now, now, NewRTT(), testMSS, c.window())
+	}
+	peak := c.window()
+	c.onCongestionEvent(now, now)
+	rtt := NewRTT()
+	rtt.Add(time.Millisecond*50, 0)
+	for i := range 2000 {
+		c.onAck(now.Add(time.Duration(i)*time.Millisecond*5), now, now, rtt, testMSS, c.window())
+	}
+
+	if c.window() < peak {
+		t.Fatalf("expected window to recover to %v, got %v", peak, c.window())
+	}
+}
+
+func TestSenderRecovery(t *testing.T) {
+	now := time.Now()
+	s := NewSender(log.NopLogger{}, now, testMSS)
+	s.OnSend(s.Available())
+	if s.Available() != 0 {
+		t.Fatalf("expected full window, got %v available", s.Available())
+	}
+
+	s.OnCongestionEvent(now.Add(time.Millisecond), now.Add(time.Millisecond))
+	if s.Available() != testMSS {
+		t.Fatalf("expected a single segment during recovery, got %v", s.Available())
+	}
+
+	s.OnCongestionEvent(now.Add(time.Millisecond*2), now)
+	s.OnSend(testMSS)
+	if s.Available() != 0 {
+		t.Fatalf("expected losses sent before recovery to be ignored, got %v available", s.Available())
+	}
+}
+
+func TestSenderAck(t *testing.T) {
+	now := time.Now()
+	s := NewSender(log.NopLogger{}, now, testMSS)
+	window := s.Available()
+	s.OnSend(window)
+	for range window / testMSS {
+		s.OnAck(now, now, NewRTT(), testMSS)
+	}
+
+	if s.Available() <= window {
+		t.Fatalf("expected window to grow after ack, got %v available", s.Available())
+	}
+}
+
+func TestPacerCapacity(t *testing.T) {
+	now := time.Now()
+	p := newPacer(now)
+	window := uint64(100 * testMSS)
+	if deadline := p.timeUntilSend(now, time.Millisecond*100, testMSS, testMSS, window); !deadline.IsZero() && deadline.After(now.Add(time.Millisecond*100)) {
+		t.Fatalf("pacer delayed the first packet by %v", deadline.Sub(now))
+	}
+
+	for range 100 {
+		p.onSend(testMSS)
+	}
+
+	deadline := p.timeUntilSend(now, time.Millisecond*100, testMSS, testMSS, window)
+	if deadline.IsZero() || !deadline.After(now) {
+		t.Fatal("expected pacer to delay a burst above its capacity")
+	}
+
+	if deadline.Sub(now) > time.Millisecond*100 {
+		t.Fatalf("pacer delayed a segment by more than an rtt: %v", deadline.Sub(now))
+	}
+}
+
+func TestPacerFrequentPolling(t *testing.T) {
+	now := time.Now()
+	p := newPacer(now)
+	window := uint64(10 * testMSS)
+	for range 100 {
+		p.onSend(testMSS)
+	}
+
+	for i := range 100_000 {
+		if deadline := p.timeUntilSend(now.Add(time.Duration(i)*time.Microsecond), time.Millisecond*100, testMSS, testMSS, window); deadline.IsZero() {
+			return
+		}
+	}
+	t.Fatal("pacer never released a segment while polled every microsecond")
+}
+
+func TestSenderResetKeepsFlight(t *testing.T) {
+	now := time.Now()
+	rtt := NewRTT()
+	s := NewSender(log.NopLogger{}, now, testMSS)
+	s.OnSend(testMSS * 4)
+	s.OnCongestionEvent(now.Add(time.Millisecond), now.Add(time.Millisecond))
+	s.Reset(log.NopLogger{}, now.Add(time.Second))
+	if expected := initialWindow(testMSS) - testMSS*4; s.Available() != expected {
+		t.Fatalf("expected %v bytes available with packets still in flight, got %v", expected, s.Available())
+	}
+
+	s.OnAck(now.Add(time.Second), now, rtt, testMSS*4)
+	if s.Available() != initialWindow(testMSS) {
+		t.Fatalf("expected the full initial window once in-flight packets were acked, got %v", s.Available())
+	}
+}
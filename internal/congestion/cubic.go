@@ -48,7 +48,7 @@ func newCubic(logger log.Logger, mss uint64) *cubic {
 }
 
 func (c *cubic) onAck(now, _, recoveryStartTime time.Time, rtt *RTT, bytes, flight uint64) {
-	if !shouldIncreaseWindow(flight, c.cwnd, c.ssthres) {
+	if !shouldIncreaseWindow(flight, c.cwnd, c.ssthres, c.maxSegmentSize) {
 		return
 	}
 
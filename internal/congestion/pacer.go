@@ -37,14 +37,16 @@ func (p *pacer) timeUntilSend(now time.Time, rtt time.Duration, bytes uint64, ms
 
 	elapsed := now.Sub(p.prev)
 	elapsedRTT := elapsed.Seconds() / rtt.Seconds()
-	newTokens := float64(window) * 1.25 * elapsedRTT
-	p.tokens = min(p.tokens+uint64(newTokens), p.capacity)
-	p.prev = now
+	if newTokens := uint64(float64(window) * 1.25 * elapsedRTT); newTokens > 0 {
+		p.tokens = min(p.tokens+newTokens, p.capacity)
+		p.prev = now
+	}
+
 	if p.tokens >= bytes {
 		return
 	}
 	unscaledDelay := uint64(rtt) * (min(bytes, p.capacity) - p.tokens) / window
-	return p.prev.Add(time.Duration(unscaledDelay/5) * 4)
+	return now.Add(time.Duration(unscaledDelay/5) * 4)
 }
 
 func (p *pacer) onSend(bytes uint64) {
@@ -27,7 +27,7 @@ func newReno(logger log.Logger, mss uint64) *reno {
 }
 
 func (r *reno) onAck(_, _, _ time.Time, _ *RTT, bytes, flight uint64) {
-	if !shouldIncreaseWindow(flight, r.cwnd, r.ssthres) {
+	if !shouldIncreaseWindow(flight, r.cwnd, r.ssthres, r.maxSegmentSize) {
 		return
 	}
 
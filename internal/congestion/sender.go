@@ -51,6 +51,13 @@ func (s *Sender) OnCongestionEvent(now time.Time, sent time.Time) {
 	}
 }
 
+func (s *Sender) Reset(logger log.Logger, now time.Time) {
+	s.recoverySend = false
+	s.recoveryStartTime = now
+	s.cc = newReno(logger, s.cc.mss())
+	s.pacer = newPacer(now)
+}
+
 func (s *Sender) SetMSS(mss uint64) {
 	s.cc.setMSS(mss)
 }
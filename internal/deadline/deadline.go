@@ -0,0 +1,44 @@
+package deadline
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/cooldogedev/spectral/internal/clock"
+)
+
+const Inf = time.Duration(math.MaxInt64)
+
+type Deadline struct {
+	clock   clock.Clock
+	t       time.Time
+	changed chan struct{}
+	mu      sync.Mutex
+}
+
+func New(clock clock.Clock) *Deadline {
+	return &Deadline{clock: clock, changed: make(chan struct{})}
+}
+
+func (d *Deadline) Set(t time.Time) {
+	d.mu.Lock()
+	d.t = t
+	close(d.changed)
+	d.changed = make(chan struct{})
+	d.mu.Unlock()
+}
+
+func (d *Deadline) Remaining() (time.Duration, <-chan struct{}) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.t.IsZero() {
+		return Inf, d.changed
+	}
+	return d.t.Sub(d.clock.Now()), d.changed
+}
+
+func (d *Deadline) Exceeded() bool {
+	remaining, _ := d.Remaining()
+	return remaining <= 0
+}
@@ -1,8 +1,63 @@
 package frame
 
-type Frame interface {
-	ID() uint32
-	Encode() []byte
-	Decode(p []byte) (int, error)
-	Reset()
-}
+import "github.com/cooldogedev/spectral/wire"
+
+type (
+	Frame                = wire.Frame
+	Acknowledgement      = wire.Acknowledgement
+	AcknowledgementRange = wire.AcknowledgementRange
+	ConnectionRequest    = wire.ConnectionRequest
+	ConnectionResponse   = wire.ConnectionResponse
+	ConnectionClose      = wire.ConnectionClose
+	StreamRequest        = wire.StreamRequest
+	StreamResponse       = wire.StreamResponse
+	StreamData           = wire.StreamData
+	StreamClose          = wire.StreamClose
+	MTURequest           = wire.MTURequest
+	MTUResponse          = wire.MTUResponse
+	PathChallenge        = wire.PathChallenge
+	PathResponse         = wire.PathResponse
+	Ping                 = wire.Ping
+	Padding              = wire.Padding
+	Retry                = wire.Retry
+	GoAway               = wire.GoAway
+	TransportParameters  = wire.TransportParameters
+)
+
+const (
+	IDAcknowledgement    = wire.IDAcknowledgement
+	IDConnectionRequest  = wire.IDConnectionRequest
+	IDConnectionResponse = wire.IDConnectionResponse
+	IDConnectionClose    = wire.IDConnectionClose
+	IDStreamRequest      = wire.IDStreamRequest
+	IDStreamResponse     = wire.IDStreamResponse
+	IDStreamData         = wire.IDStreamData
+	IDStreamClose        = wire.IDStreamClose
+	IDMTURequest         = wire.IDMTURequest
+	IDMTUResponse        = wire.IDMTUResponse
+	IDPathChallenge      = wire.IDPathChallenge
+	IDPathResponse       = wire.IDPathResponse
+	IDPing               = wire.IDPing
+	IDPadding            = wire.IDPadding
+	IDRetry              = wire.IDRetry
+	IDGoAway             = wire.IDGoAway
+)
+
+const (
+	ConnectionCloseApplication = wire.ConnectionCloseApplication
+	ConnectionCloseGraceful    = wire.ConnectionCloseGraceful
+	ConnectionCloseTimeout     = wire.ConnectionCloseTimeout
+	ConnectionCloseInternal    = wire.ConnectionCloseInternal
+
+	ConnectionResponseSuccess = wire.ConnectionResponseSuccess
+	ConnectionResponseFailed  = wire.ConnectionResponseFailed
+
+	StreamResponseSuccess = wire.StreamResponseSuccess
+	StreamResponseFailed  = wire.StreamResponseFailed
+
+	TransportParameterIdleTimeout         = wire.TransportParameterIdleTimeout
+	TransportParameterMaxStreams          = wire.TransportParameterMaxStreams
+	TransportParameterStreamReceiveWindow = wire.TransportParameterStreamReceiveWindow
+	TransportParameterMaxDatagramSize     = wire.TransportParameterMaxDatagramSize
+	TransportParameterExtensions          = wire.TransportParameterExtensions
+)
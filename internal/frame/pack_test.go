@@ -0,0 +1,65 @@
+package frame
+
+import (
+	"testing"
+
+	"github.com/cooldogedev/spectral/internal/protocol"
+	"github.com/cooldogedev/spectral/wire"
+)
+
+func seedFrames() []byte {
+	parameters := TransportParameters{IdleTimeout: 30000, MaxStreams: 100}
+	var frames []byte
+	for _, fr := range []Frame{
+		&Acknowledgement{Delay: 25, Max: 10, Ranges: []AcknowledgementRange{{1, 4}, {6, 10}}},
+		&ConnectionRequest{Version: protocol.Version, Token: []byte("token"), Parameters: parameters},
+		&ConnectionResponse{ConnectionID: 7, Version: protocol.Version, Parameters: parameters},
+		&ConnectionClose{Code: ConnectionCloseGraceful, Message: "bye"},
+		&StreamRequest{StreamID: 3},
+		&StreamResponse{StreamID: 3},
+		&StreamData{StreamID: 3, SequenceID: 9, Payload: []byte("payload")},
+		&StreamClose{StreamID: 3},
+		&MTURequest{MTU: 64},
+		&MTUResponse{MTU: 1400},
+		&PathChallenge{},
+		&PathResponse{},
+		&Ping{},
+		&Retry{Token: []byte("retry")},
+		&GoAway{},
+	} {
+		frames = append(frames, PackSingle(fr)...)
+	}
+	return frames
+}
+
+func FuzzUnpack(f *testing.F) {
+	f.Add(Pack(1, 1, seedFrames()))
+	f.Add(Pack(-1, 1, PackSingle(&ConnectionRequest{Version: protocol.Version, Token: []byte("token")})))
+	f.Add(Pack(-1, 0, PackSingle(&Padding{Length: 32})))
+	f.Add(append(Pack(1, 1, nil), 0x01, 0x00))
+
+	var r Reader
+	f.Fuzz(func(t *testing.T, p []byte) {
+		connectionID, sequenceID, frameID, err := r.Unpack(p)
+		header, headerErr := wire.ParseHeader(p)
+		if err != nil {
+			return
+		}
+
+		if headerErr != nil || header.ConnectionID != connectionID || header.SequenceID != sequenceID {
+			t.Fatalf("unpacked %v %v, expected %+v (%v)", connectionID, sequenceID, header, headerErr)
+		}
+
+		if fr, err := r.Request(p[protocol.PacketHeaderSize:]); err == nil && frameID != IDConnectionRequest {
+			t.Fatalf("decoded request %#v from a packet starting with frame %v", fr, frameID)
+		}
+
+		for p := p[protocol.PacketHeaderSize:]; len(p) > 0; {
+			_, n, err := r.Next(p)
+			if err != nil {
+				return
+			}
+			p = p[n:]
+		}
+	})
+}
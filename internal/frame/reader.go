@@ -0,0 +1,89 @@
+package frame
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/cooldogedev/spectral/internal/protocol"
+	"github.com/cooldogedev/spectral/wire"
+)
+
+type Reader struct {
+	frames [IDGoAway + 1]Frame
+}
+
+func (r *Reader) Next(p []byte) (Frame, int, error) {
+	frameID, err := wire.ParseFrameID(p)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if frameID >= uint32(len(r.frames)) {
+		return nil, 0, fmt.Errorf("unknown frame: %v", frameID)
+	}
+
+	fr := r.frames[frameID]
+	if fr == nil {
+		fr, _ = wire.NewFrame(frameID)
+		r.frames[frameID] = fr
+	}
+	fr.Reset()
+
+	var n int
+	if data, ok := fr.(*StreamData); ok {
+		n, err = decodeStreamData(data, p[4:])
+	} else {
+		n, err = fr.Decode(p[4:])
+	}
+
+	if err != nil {
+		return nil, 0, fmt.Errorf("error while decoding frame %v: %v", frameID, err)
+	}
+	return fr, 4 + n, nil
+}
+
+func (r *Reader) Unpack(p []byte) (connectionID protocol.ConnectionID, sequenceID uint32, frameID uint32, err error) {
+	header, err := wire.ParseHeader(p)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	frameID, err = wire.ParseFrameID(p[protocol.PacketHeaderSize:])
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	if frameID >= uint32(len(r.frames)) {
+		return 0, 0, 0, fmt.Errorf("unknown frame: %v", frameID)
+	}
+	return header.ConnectionID, header.SequenceID, frameID, nil
+}
+
+func (r *Reader) Request(p []byte) (*ConnectionRequest, error) {
+	fr, _, err := r.Next(p)
+	if err != nil {
+		return nil, err
+	}
+
+	request, ok := fr.(*ConnectionRequest)
+	if !ok {
+		return nil, fmt.Errorf("expected a connection request, got frame %v", fr.ID())
+	}
+	return request, nil
+}
+
+func decodeStreamData(fr *StreamData, p []byte) (int, error) {
+	if len(p) < 16 {
+		return 0, errors.New("not enough data to decode")
+	}
+
+	payloadLength := binary.LittleEndian.Uint32(p[12:16])
+	if uint64(len(p)) < 16+uint64(payloadLength) {
+		return 16, errors.New("not enough data to decode payload")
+	}
+	fr.StreamID = wire.StreamID(binary.LittleEndian.Uint64(p[0:8]))
+	fr.SequenceID = binary.LittleEndian.Uint32(p[8:12])
+	fr.Payload = p[16 : 16+payloadLength : 16+payloadLength]
+	return 16 + int(payloadLength), nil
+}
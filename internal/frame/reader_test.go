@@ -0,0 +1,148 @@
+package frame
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+
+	"github.com/cooldogedev/spectral/internal/protocol"
+	"github.com/cooldogedev/spectral/wire"
+)
+
+func FuzzReader(f *testing.F) {
+	f.Add(seedFrames())
+	f.Add(PackSingle(&Padding{Length: 32}))
+	f.Add([]byte{0x01, 0x00})
+
+	var r Reader
+	f.Fuzz(func(t *testing.T, p []byte) {
+		for len(p) > 0 {
+			fr, n, err := r.Next(p)
+			expected, m, expectedErr := wire.ParseFrame(p)
+			if (err == nil) != (expectedErr == nil) {
+				t.Fatalf("reader error %v does not match parse error %v", err, expectedErr)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if n != m {
+				t.Fatalf("reader consumed %v bytes, expected %v", n, m)
+			}
+
+			if !bytes.Equal(Append(nil, fr), Append(nil, expected)) {
+				t.Fatalf("reader decoded %#v, expected %#v", fr, expected)
+			}
+			p = p[n:]
+		}
+	})
+}
+
+func TestReaderTruncatedFrameID(t *testing.T) {
+	var r Reader
+	if _, _, _, err := r.Unpack(append(AppendHeader(nil, 1, 1), 0x01, 0x00)); err == nil {
+		t.Fatal("expected truncated frame id to be rejected")
+	}
+}
+
+func TestReaderUnpack(t *testing.T) {
+	p := Pack(7, 3, Append(PackSingle(&Ping{}), &StreamClose{StreamID: 1}))
+
+	var r Reader
+	connectionID, sequenceID, frameID, err := r.Unpack(p[:len(p)-1])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if connectionID != 7 || sequenceID != 3 || frameID != IDPing {
+		t.Fatalf("unexpected header %v %v %v", connectionID, sequenceID, frameID)
+	}
+
+	if _, _, _, err := r.Unpack(Pack(7, 3, binary.LittleEndian.AppendUint32(nil, IDGoAway+1))); err == nil {
+		t.Fatal("expected an unknown frame id to be rejected")
+	}
+}
+
+func TestReaderRequest(t *testing.T) {
+	request := &ConnectionRequest{Version: protocol.Version, Token: []byte("token")}
+	p := PackSingle(request)
+
+	var r Reader
+	fr, err := r.Request(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(fr, request) {
+		t.Fatalf("expected %#v, got %#v", request, fr)
+	}
+
+	if _, err := r.Request(PackSingle(&Ping{})); err == nil {
+		t.Fatal("expected a packet without a leading connection request to be rejected")
+	}
+
+	if _, err := r.Request(p[:len(p)-1]); err == nil {
+		t.Fatal("expected a truncated request to be rejected")
+	}
+}
+
+func TestReaderStreamDataAliasesInput(t *testing.T) {
+	var r Reader
+	p := PackSingle(&StreamData{StreamID: 3, SequenceID: 9, Payload: []byte("payload")})
+	fr, _, err := r.Next(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload := fr.(*StreamData).Payload
+	if string(payload) != "payload" {
+		t.Fatalf("unexpected payload %q", payload)
+	}
+
+	p[len(p)-1] = 'X'
+	if string(payload) != "payloaX" {
+		t.Fatal("expected the payload to alias the input")
+	}
+}
+
+func TestReaderAcknowledgementGrows(t *testing.T) {
+	ranges := make([]AcknowledgementRange, 512)
+	for i := range ranges {
+		ranges[i] = AcknowledgementRange{uint32(i * 3), uint32(i*3 + 1)}
+	}
+
+	var r Reader
+	for _, length := range []int{2, len(ranges), 1} {
+		fr, _, err := r.Next(PackSingle(&Acknowledgement{Ranges: ranges[:length]}))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := len(fr.(*Acknowledgement).Ranges); got != length {
+			t.Fatalf("expected %v ranges, got %v", length, got)
+		}
+	}
+}
+
+func TestReaderDoesNotAllocate(t *testing.T) {
+	p := PackSingle(&Acknowledgement{Max: 10, Ranges: []AcknowledgementRange{{1, 4}, {6, 10}}})
+	p = Append(p, &StreamData{StreamID: 3, SequenceID: 9, Payload: make([]byte, 1200)})
+	p = Append(p, &Ping{})
+
+	var r Reader
+	walk := func() {
+		for p := p; len(p) > 0; {
+			_, n, err := r.Next(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p = p[n:]
+		}
+	}
+	walk()
+	if allocs := testing.AllocsPerRun(100, walk); allocs > 0 {
+		t.Fatalf("expected no allocations, got %v", allocs)
+	}
+}
@@ -1,25 +1,37 @@
 package protocol
 
-import "time"
+import (
+	"time"
 
-var Magic = []byte{0x20, 0x24, 0x10, 0x01}
+	"github.com/cooldogedev/spectral/wire"
+)
 
-type ConnectionID int64
+const Magic = wire.Magic
 
-type StreamID int64
+const Version = wire.Version
+
+type ConnectionID = wire.ConnectionID
+
+type StreamID = wire.StreamID
 
 const SendBufferSize = 1024 * 1024 * 7
 
 const ReceiveBufferSize = 1024 * 1024 * 7
 
-const PacketHeaderSize = 16
+const PacketHeaderSize = wire.HeaderSize
 
 const MaxUDPPayloadSize = 1472
 
+const MaxUDPPayloadSizeLimit = 65507
+
 const MinPacketSize = 1200
 
 const MaxPacketSize = 1452
 
+const PacketOverhead = MaxUDPPayloadSize - MaxPacketSize
+
+const MinUDPPayloadSize = MinPacketSize + PacketOverhead
+
 const MaxAckDelay = time.Millisecond * 25
 
 const MaxAckRanges = 128
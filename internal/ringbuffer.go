@@ -2,6 +2,8 @@ package internal
 
 import "errors"
 
+const ringBufferInitialSize = 4096
+
 type RingBuffer[T any] struct {
 	data   []T
 	size   int
@@ -10,35 +12,38 @@ type RingBuffer[T any] struct {
 }
 
 func NewRingBuffer[T any](size int) *RingBuffer[T] {
-	return &RingBuffer[T]{
-		data: make([]T, size),
-		size: size,
-	}
+	return &RingBuffer[T]{size: size}
 }
 
 func (r *RingBuffer[T]) Write(p []T) (int, error) {
-	if len(p) > r.size-r.length {
+	if len(p) > r.Free() {
 		return 0, errors.New("insufficient space")
 	}
 
-	for i := 0; i < len(p); i++ {
-		r.data[(r.start+r.length)%r.size] = p[i]
-		r.length++
+	if len(p) == 0 {
+		return 0, nil
 	}
+
+	r.grow(r.length + len(p))
+	n := copy(r.data[(r.start+r.length)%len(r.data):], p)
+	copy(r.data, p[n:])
+	r.length += len(p)
 	return len(p), nil
 }
 
 func (r *RingBuffer[T]) Read(p []T) int {
-	n := len(p)
-	if n > r.length {
-		n = r.length
+	n := min(len(p), r.length)
+	if n == 0 {
+		return 0
 	}
 
-	for i := 0; i < n; i++ {
-		p[i] = r.data[(r.start+i)%r.size]
-	}
-	r.start = (r.start + n) % r.size
+	first := copy(p[:n], r.data[r.start:])
+	copy(p[first:n], r.data)
+	r.start = (r.start + n) % len(r.data)
 	r.length -= n
+	if r.length == 0 {
+		r.start = 0
+	}
 	return n
 }
 
@@ -47,16 +52,28 @@ func (r *RingBuffer[T]) Len() int {
 }
 
 func (r *RingBuffer[T]) Free() int {
-	if len(r.data) == 0 {
-		return 0
-	}
 	return r.size - r.length
 }
 
 func (r *RingBuffer[T]) Reset() {
-	r.data = r.data[:0]
 	r.data = nil
 	r.length = 0
 	r.size = 0
 	r.start = 0
 }
+
+func (r *RingBuffer[T]) grow(length int) {
+	if length <= len(r.data) {
+		return
+	}
+
+	size := max(len(r.data)*2, ringBufferInitialSize)
+	for size < length {
+		size *= 2
+	}
+
+	data := make([]T, min(size, r.size))
+	r.length = r.Read(data)
+	r.data = data
+	r.start = 0
+}
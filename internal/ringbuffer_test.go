@@ -0,0 +1,81 @@
+package internal
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRingBufferGrowsLazily(t *testing.T) {
+	r := NewRingBuffer[byte](1 << 20)
+	if len(r.data) != 0 {
+		t.Fatalf("expected no storage before the first write, got %v", len(r.data))
+	}
+
+	_, _ = r.Write(make([]byte, 10))
+	if len(r.data) != ringBufferInitialSize {
+		t.Fatalf("expected initial storage of %v, got %v", ringBufferInitialSize, len(r.data))
+	}
+
+	_, _ = r.Write(make([]byte, ringBufferInitialSize*3))
+	if len(r.data) != ringBufferInitialSize*4 {
+		t.Fatalf("expected storage of %v, got %v", ringBufferInitialSize*4, len(r.data))
+	}
+}
+
+func TestRingBufferLimit(t *testing.T) {
+	r := NewRingBuffer[byte](6000)
+	if _, err := r.Write(make([]byte, 6000)); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(r.data) != 6000 {
+		t.Fatalf("expected storage capped at the limit, got %v", len(r.data))
+	}
+
+	if _, err := r.Write([]byte{1}); err == nil {
+		t.Fatal("expected write beyond the limit to fail")
+	}
+}
+
+func TestRingBufferWrap(t *testing.T) {
+	r := NewRingBuffer[byte](ringBufferInitialSize)
+	var written, read []byte
+	buf := make([]byte, 1000)
+	for i := range 64 {
+		p := bytes.Repeat([]byte{byte(i)}, 700+i)
+		if _, err := r.Write(p); err != nil {
+			t.Fatal(err)
+		}
+		written = append(written, p...)
+
+		n := r.Read(buf)
+		read = append(read, buf[:n]...)
+	}
+
+	for r.Len() > 0 {
+		n := r.Read(buf)
+		read = append(read, buf[:n]...)
+	}
+
+	if !bytes.Equal(written, read) {
+		t.Fatal("data read does not match data written")
+	}
+
+	if len(r.data) != ringBufferInitialSize {
+		t.Fatalf("expected storage to stay at %v, got %v", ringBufferInitialSize, len(r.data))
+	}
+}
+
+func TestRingBufferGrowWhileWrapped(t *testing.T) {
+	r := NewRingBuffer[byte](1 << 20)
+	_, _ = r.Write(bytes.Repeat([]byte{1}, ringBufferInitialSize))
+	r.Read(make([]byte, ringBufferInitialSize-10))
+	_, _ = r.Write(bytes.Repeat([]byte{2}, ringBufferInitialSize))
+
+	buf := make([]byte, ringBufferInitialSize*2)
+	n := r.Read(buf)
+	expected := append(bytes.Repeat([]byte{1}, 10), bytes.Repeat([]byte{2}, ringBufferInitialSize)...)
+	if !bytes.Equal(buf[:n], expected) {
+		t.Fatal("growing a wrapped buffer reordered its contents")
+	}
+}
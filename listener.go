@@ -3,89 +3,146 @@ package spectral
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net"
-	"slices"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/cooldogedev/spectral/internal/frame"
+	"github.com/cooldogedev/spectral/internal/log"
 	"github.com/cooldogedev/spectral/internal/protocol"
 )
 
+const (
+	shutdownPollInterval = time.Millisecond * 50
+	admissionWorkers     = 4
+	admissionQueueLength = 128
+)
+
 type Listener struct {
-	conn                *udpConn
-	connections         map[protocol.ConnectionID]*ServerConnection
-	connectionsMu       sync.Mutex
-	connectionID        protocol.ConnectionID
+	config              *Config
+	shards              []*listenerShard
+	admission           *admission
+	metrics             *listenerMetrics
 	incomingConnections chan *ServerConnection
+	retry               *retryTokens
+	admissions          chan admissionRequest
+	draining            atomic.Bool
+	shared              bool
+	logger              log.Logger
 	ctx                 context.Context
 	cancelFunc          context.CancelFunc
 	once                sync.Once
 }
 
-func newListener(conn *udpConn) *Listener {
+func newListener(conns []*udpConn, config *Config, shared bool) *Listener {
 	listener := &Listener{
-		conn:                conn,
-		connections:         make(map[protocol.ConnectionID]*ServerConnection),
-		incomingConnections: make(chan *ServerConnection, 100),
+		config:              config,
+		admission:           newAdmission(),
+		metrics:             &listenerMetrics{},
+		incomingConnections: make(chan *ServerConnection, config.AcceptQueueLength),
+		shared:              shared,
+		logger:              log.NewLogger(log.PerspectiveServer),
+	}
+	listener.logger.SetConnectionID(-1)
+	if config.RequireAddressValidation {
+		listener.retry = newRetryTokens()
 	}
 	listener.ctx, listener.cancelFunc = context.WithCancel(context.Background())
-	go conn.Read(func(dgram *datagram) (err error) {
-		defer dgram.reset()
-		connectionID, sequenceID, frames, err := frame.Unpack(dgram.b)
-		if err != nil {
-			return nil
-		}
-
-		listener.connectionsMu.Lock()
-		defer listener.connectionsMu.Unlock()
-		c, ok := listener.connections[connectionID]
-		if !ok && slices.ContainsFunc(frames, func(fr frame.Frame) bool { return fr.ID() == frame.IDConnectionRequest }) {
-			c = newServerConnection(conn, dgram.peerAddr, listener.connectionID, listener.ctx)
-			c.logger.Log("connection_accepted", "addr", dgram.peerAddr.String())
-			listener.connections[listener.connectionID] = c
-			listener.connectionID++
-			listener.incomingConnections <- c
-			go func() {
-				<-c.ctx.Done()
-				listener.connectionsMu.Lock()
-				delete(listener.connections, protocol.ConnectionID(c.connectionID.Load()))
-				listener.connectionsMu.Unlock()
-			}()
-		}
-
-		if c == nil {
-			return
-		}
+	for i, conn := range conns {
+		listener.shards = append(listener.shards, newListenerShard(listener, conn, i))
+	}
 
-		select {
-		case <-listener.ctx.Done():
-			return context.Cause(listener.ctx)
-		case <-c.ctx.Done():
-		default:
-			c.packets <- &receivedPacket{sequenceID, frames, time.Now()}
+	if config.AdmitAddress != nil || config.AdmitConnection != nil {
+		listener.admissions = make(chan admissionRequest, admissionQueueLength)
+		for range admissionWorkers {
+			go listener.admit()
 		}
-		return
-	})
+	}
 	return listener
 }
 
 func Listen(address string) (*Listener, error) {
-	addr, err := net.ResolveUDPAddr("udp", address)
+	return ListenConfig(address, nil)
+}
+
+func ListenConfig(address string, config *Config) (*Listener, error) {
+	config, err := populateConfig(config)
 	if err != nil {
 		return nil, err
 	}
 
-	conn, err := net.ListenUDP("udp", addr)
+	conns, err := listenUDP(address, config.Shards)
+	if err != nil {
+		return nil, err
+	}
+
+	uConns := make([]*udpConn, 0, len(conns))
+	for _, conn := range conns {
+		c, err := newUDPConn(conn, true, config.MaxUDPPayloadSize)
+		if err != nil {
+			for _, conn := range conns {
+				_ = conn.Close()
+			}
+			return nil, err
+		}
+		uConns = append(uConns, c)
+	}
+	listener := newListener(uConns, config, false)
+	for _, shard := range listener.shards {
+		go shard.read()
+	}
+	return listener, nil
+}
+
+func ListenPacketConn(conn net.PacketConn, config *Config) (*Listener, error) {
+	config, err := populateConfig(config)
 	if err != nil {
 		return nil, err
 	}
 
-	c, err := newUDPConn(conn, true)
+	c, err := newUDPConn(conn, true, config.MaxUDPPayloadSize)
 	if err != nil {
 		return nil, err
 	}
-	return newListener(c), nil
+
+	listener := newListener([]*udpConn{c}, config, false)
+	go listener.shards[0].read()
+	return listener, nil
+}
+
+func listenUDP(address string, shards int) ([]*net.UDPConn, error) {
+	if shards <= 1 || !reusePortSupported {
+		addr, err := net.ResolveUDPAddr("udp", address)
+		if err != nil {
+			return nil, err
+		}
+
+		conn, err := net.ListenUDP("udp", addr)
+		if err != nil {
+			return nil, err
+		}
+		return []*net.UDPConn{conn}, nil
+	}
+
+	config := net.ListenConfig{Control: func(_, _ string, conn syscall.RawConn) error {
+		return setReusePort(conn)
+	}}
+	conns := make([]*net.UDPConn, 0, shards)
+	for range shards {
+		conn, err := config.ListenPacket(context.Background(), "udp", address)
+		if err != nil {
+			for _, conn := range conns {
+				_ = conn.Close()
+			}
+			return nil, err
+		}
+		conns = append(conns, conn.(*net.UDPConn))
+		address = conn.LocalAddr().String()
+	}
+	return conns, nil
 }
 
 func (l *Listener) Accept(ctx context.Context) (Connection, error) {
@@ -99,14 +156,173 @@ func (l *Listener) Accept(ctx context.Context) (Connection, error) {
 	}
 }
 
+func (l *Listener) admit() {
+	for {
+		select {
+		case <-l.ctx.Done():
+			return
+		case req := <-l.admissions:
+			req.shard.admit(req)
+		}
+	}
+}
+
+func (l *Listener) check(shard *listenerShard, connectionID protocol.ConnectionID, addr net.Addr, request *frame.ConnectionRequest) (validated bool, ok bool) {
+	if request.Version != protocol.Version {
+		shard.reject(connectionID, addr, fmt.Sprintf("unsupported protocol version %v, expected %v", request.Version, protocol.Version))
+		return false, false
+	}
+
+	if l.draining.Load() {
+		shard.reject(connectionID, addr, "listener shutting down")
+		return false, false
+	}
+
+	if l.retry != nil {
+		now := l.config.Clock.Now()
+		if len(request.Token) == 0 {
+			shard.write(connectionID, addr, &frame.Retry{Token: l.retry.generate(now, addr)})
+			return false, false
+		}
+
+		if !l.retry.validate(now, addr, request.Token) {
+			shard.reject(connectionID, addr, "invalid retry token")
+			return false, false
+		}
+		validated = true
+	}
+	return validated, true
+}
+
+func (l *Listener) accept(shard *listenerShard, key handshakeKey, addr net.Addr, request *frame.ConnectionRequest, validated bool) *ServerConnection {
+	connectionID := key.connectionID
+	if l.config.AdmitAddress != nil {
+		if err := l.config.AdmitAddress(addr); err != nil {
+			shard.reject(connectionID, addr, err.Error())
+			return nil
+		}
+	}
+
+	if reason, ok := l.admission.reserve(addr, l.config.MaxConnectionsPerIP, l.config.MaxConnectionsPerSubnet); !ok {
+		shard.reject(connectionID, addr, reason)
+		return nil
+	}
+
+	if l.config.AdmitConnection != nil {
+		if err := l.config.AdmitConnection(addr, newHandshakeParameters(request)); err != nil {
+			l.admission.remove(addr)
+			shard.reject(connectionID, addr, err.Error())
+			return nil
+		}
+	}
+
+	if len(l.incomingConnections) >= cap(l.incomingConnections) {
+		l.admission.remove(addr)
+		l.metrics.refusedConnections.Add(1)
+		shard.reject(connectionID, addr, "accept queue full")
+		return nil
+	}
+
+	c := newServerConnection(shard.conn, addr, shard.nextConnectionID(), connectionID, l.ctx, l.config, l.metrics)
+	c.validated.Store(validated)
+	shard.mu.Lock()
+	shard.add(key, c)
+	shard.mu.Unlock()
+	go func() {
+		<-c.done
+		shard.remove(key, c)
+		l.admission.remove(addr)
+	}()
+
+	select {
+	case l.incomingConnections <- c:
+	default:
+		l.metrics.refusedConnections.Add(1)
+		_ = c.CloseWithError(frame.ConnectionCloseInternal, "accept queue full")
+		return nil
+	}
+	c.logger.Log("connection_accepted", "addr", key.addr, "validated", validated, "shard", shard.index)
+	return c
+}
+
+func (l *Listener) Addr() net.Addr {
+	return l.shards[0].conn.LocalAddr()
+}
+
+func (l *Listener) Metrics() ListenerMetrics {
+	return l.metrics.snapshot()
+}
+
+func (l *Listener) Shutdown(ctx context.Context) (err error) {
+	l.draining.Store(true)
+	for _, conn := range l.all() {
+		_ = conn.sendGoAway()
+	}
+
+	timer := l.config.Clock.NewTimer(shutdownPollInterval)
+	defer timer.Stop()
+shutdownLoop:
+	for {
+		drained := true
+		for _, conn := range l.all() {
+			if !conn.drained() {
+				drained = false
+				break
+			}
+		}
+
+		if drained {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			err = context.Cause(ctx)
+			break shutdownLoop
+		case <-l.ctx.Done():
+			return
+		case <-timer.C():
+			timer.Reset(shutdownPollInterval)
+		}
+	}
+	_ = l.Close()
+	return
+}
+
 func (l *Listener) Close() (err error) {
 	l.once.Do(func() {
-		for i, conn := range l.connections {
-			_ = conn.CloseWithError(frame.ConnectionCloseGraceful, "closed listener")
-			delete(l.connections, i)
+		var wg sync.WaitGroup
+		for _, conn := range l.all() {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_ = conn.CloseWithError(frame.ConnectionCloseGraceful, "closed listener")
+			}()
 		}
+		wg.Wait()
 		l.cancelFunc()
-		_ = l.conn.Close()
+		for _, shard := range l.shards {
+			shard.close()
+		}
+		l.logger.Close()
 	})
 	return
 }
+
+func (l *Listener) all() (list []*ServerConnection) {
+	for _, shard := range l.shards {
+		list = shard.all(list)
+	}
+	return
+}
+
+func (l *Listener) shard(connectionID protocol.ConnectionID) *listenerShard {
+	return l.shards[connectionID%protocol.ConnectionID(len(l.shards))]
+}
+
+func (l *Listener) route(shard *listenerShard, connectionID protocol.ConnectionID) *listenerShard {
+	if connectionID >= 0 {
+		return l.shard(connectionID)
+	}
+	return shard
+}
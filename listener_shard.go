@@ -0,0 +1,214 @@
+package spectral
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"net"
+	"sync"
+
+	"github.com/cooldogedev/spectral/internal/frame"
+	"github.com/cooldogedev/spectral/internal/protocol"
+)
+
+type handshakeKey struct {
+	addr         string
+	connectionID protocol.ConnectionID
+}
+
+type admissionRequest struct {
+	shard      *listenerShard
+	key        handshakeKey
+	sequenceID uint32
+	request    frame.ConnectionRequest
+	validated  bool
+	dgram      *datagram
+}
+
+type listenerShard struct {
+	listener    *Listener
+	conn        *udpConn
+	index       int
+	connections map[protocol.ConnectionID]*ServerConnection
+	handshakes  map[handshakeKey]*ServerConnection
+	pending     map[handshakeKey]struct{}
+	mu          sync.Mutex
+}
+
+func newListenerShard(listener *Listener, conn *udpConn, index int) *listenerShard {
+	return &listenerShard{
+		listener:    listener,
+		conn:        conn,
+		index:       index,
+		connections: make(map[protocol.ConnectionID]*ServerConnection),
+		handshakes:  make(map[handshakeKey]*ServerConnection),
+		pending:     make(map[handshakeKey]struct{}),
+	}
+}
+
+func (s *listenerShard) read() {
+	var reader frame.Reader
+	s.conn.Read(func(dgram *datagram) (err error) {
+		connectionID, sequenceID, frameID, err := unpack(&reader, dgram.b, s.listener.logger)
+		if err != nil {
+			dgram.reset()
+			return nil
+		}
+		return s.listener.route(s, connectionID).receive(&reader, connectionID, sequenceID, frameID, dgram)
+	})
+}
+
+func (s *listenerShard) receive(reader *frame.Reader, connectionID protocol.ConnectionID, sequenceID uint32, frameID uint32, dgram *datagram) error {
+	var key handshakeKey
+	pending := false
+	s.mu.Lock()
+	c, ok := s.connections[connectionID]
+	if !ok {
+		key = handshakeKey{dgram.peerAddr.String(), connectionID}
+		if connectionID < 0 {
+			c, ok = s.handshakes[key]
+		}
+		_, pending = s.pending[key]
+	}
+
+	if ok && !c.validated.Load() && connectionID == protocol.ConnectionID(c.connectionID.Load()) {
+		c.validated.Store(true)
+		c.logger.Log("address_validated", "addr", dgram.peerAddr.String())
+	}
+	s.mu.Unlock()
+
+	if !ok && !pending && frameID == frame.IDConnectionRequest {
+		s.handshake(reader, key, sequenceID, dgram)
+		return nil
+	}
+
+	if !ok {
+		dgram.reset()
+		return nil
+	}
+
+	select {
+	case <-s.listener.ctx.Done():
+		dgram.reset()
+		return context.Cause(s.listener.ctx)
+	default:
+		s.deliver(c, sequenceID, dgram)
+	}
+	return nil
+}
+
+func (s *listenerShard) handshake(reader *frame.Reader, key handshakeKey, sequenceID uint32, dgram *datagram) {
+	fr, err := request(reader, dgram.b[protocol.PacketHeaderSize:], s.listener.logger)
+	if err != nil {
+		dgram.reset()
+		return
+	}
+
+	validated, ok := s.listener.check(s, key.connectionID, dgram.peerAddr, fr)
+	if !ok {
+		dgram.reset()
+		return
+	}
+
+	req := admissionRequest{shard: s, key: key, sequenceID: sequenceID, request: *fr, validated: validated, dgram: dgram}
+	req.request.Token = nil
+	if s.listener.admissions == nil {
+		s.admit(req)
+		return
+	}
+
+	s.mu.Lock()
+	s.pending[key] = struct{}{}
+	s.mu.Unlock()
+	select {
+	case s.listener.admissions <- req:
+	default:
+		s.mu.Lock()
+		delete(s.pending, key)
+		s.mu.Unlock()
+		s.listener.logger.Log("admission_dropped", "addr", key.addr)
+		dgram.reset()
+	}
+}
+
+func (s *listenerShard) admit(req admissionRequest) {
+	c := s.listener.accept(s, req.key, req.dgram.peerAddr, &req.request, req.validated)
+	s.mu.Lock()
+	delete(s.pending, req.key)
+	s.mu.Unlock()
+	if c == nil {
+		req.dgram.reset()
+		return
+	}
+	s.deliver(c, req.sequenceID, req.dgram)
+}
+
+func (s *listenerShard) deliver(c *ServerConnection, sequenceID uint32, dgram *datagram) {
+	select {
+	case <-c.done:
+		dgram.reset()
+	default:
+		c.bytesReceived.Add(uint64(len(dgram.b)))
+		c.deliver(newReceivedPacket(dgram, sequenceID, c.clock.Now()))
+	}
+}
+
+func (s *listenerShard) nextConnectionID() protocol.ConnectionID {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	shards := protocol.ConnectionID(len(s.listener.shards))
+	for {
+		var b [8]byte
+		_, _ = rand.Read(b[:])
+		connectionID := protocol.ConnectionID(binary.LittleEndian.Uint64(b[:])>>1)/shards*shards + protocol.ConnectionID(s.index)
+		if _, ok := s.connections[connectionID]; !ok {
+			return connectionID
+		}
+	}
+}
+
+func (s *listenerShard) add(key handshakeKey, c *ServerConnection) {
+	s.connections[protocol.ConnectionID(c.connectionID.Load())] = c
+	s.handshakes[key] = c
+}
+
+func (s *listenerShard) remove(key handshakeKey, c *ServerConnection) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.connections, protocol.ConnectionID(c.connectionID.Load()))
+	if s.handshakes[key] == c {
+		delete(s.handshakes, key)
+	}
+}
+
+func (s *listenerShard) all(list []*ServerConnection) []*ServerConnection {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, conn := range s.connections {
+		list = append(list, conn)
+	}
+	return list
+}
+
+func (s *listenerShard) reject(connectionID protocol.ConnectionID, addr net.Addr, reason string) {
+	s.write(connectionID, addr, &frame.ConnectionResponse{
+		ConnectionID: connectionID,
+		Response:     frame.ConnectionResponseFailed,
+		Version:      protocol.Version,
+		Reason:       reason,
+	})
+}
+
+func (s *listenerShard) write(connectionID protocol.ConnectionID, addr net.Addr, fr frame.Frame) {
+	_, _ = s.conn.Write(frame.Pack(connectionID, 0, frame.PackSingle(fr)), addr)
+}
+
+func (s *listenerShard) close() {
+	s.mu.Lock()
+	clear(s.connections)
+	clear(s.handshakes)
+	s.mu.Unlock()
+	if !s.listener.shared {
+		_ = s.conn.conn.Close()
+	}
+}
@@ -0,0 +1,463 @@
+package spectral
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cooldogedev/spectral/internal/frame"
+	"github.com/cooldogedev/spectral/internal/protocol"
+	"github.com/cooldogedev/spectral/spectraltest"
+)
+
+type generatorPacketConn struct {
+	discardPacketConn
+	generators chan func(p []byte) int
+	generate   func(p []byte) int
+}
+
+func newGeneratorPacketConn() *generatorPacketConn {
+	return &generatorPacketConn{
+		discardPacketConn: discardPacketConn{closed: make(chan struct{})},
+		generators:        make(chan func(p []byte) int),
+	}
+}
+
+func (g *generatorPacketConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	for {
+		if g.generate != nil {
+			if n := g.generate(p); n > 0 {
+				return n, spectraltest.Addr("peer"), nil
+			}
+			g.generate = nil
+		}
+
+		select {
+		case <-g.closed:
+			return 0, nil, net.ErrClosed
+		case g.generate = <-g.generators:
+		}
+	}
+}
+
+func (g *generatorPacketConn) send(connectionID protocol.ConnectionID, sequenceID uint32, fr frame.Frame) {
+	sent := false
+	g.generators <- func(p []byte) int {
+		if sent {
+			return 0
+		}
+		sent = true
+		return len(frame.Append(frame.AppendHeader(p[:0], connectionID, sequenceID), fr))
+	}
+}
+
+func writeRaw(t *testing.T, conn net.PacketConn, addr net.Addr, connectionID protocol.ConnectionID, sequenceID uint32, fr frame.Frame) {
+	t.Helper()
+	if _, err := conn.WriteTo(frame.Pack(connectionID, sequenceID, frame.PackSingle(fr)), addr); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readRaw[T frame.Frame](t *testing.T, conn net.PacketConn) T {
+	t.Helper()
+	var reader frame.Reader
+	buf := make([]byte, protocol.MaxUDPPayloadSize)
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+	defer conn.SetReadDeadline(time.Time{})
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for p := buf[protocol.PacketHeaderSize:n]; len(p) > 0; {
+			fr, length, err := reader.Next(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p = p[length:]
+
+			if fr, ok := fr.(T); ok {
+				return fr
+			}
+		}
+	}
+}
+
+func TestListenerRejectsVersionMismatch(t *testing.T) {
+	clientPacket, serverPacket := spectraltest.Pipe(spectraltest.LinkConfig{})
+	listener, err := ListenPacketConn(serverPacket, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	writeRaw(t, clientPacket, serverPacket.LocalAddr(), -1, 1, &frame.ConnectionRequest{Version: protocol.Version + 1})
+	response := readRaw[*frame.ConnectionResponse](t, clientPacket)
+	if response.Response != frame.ConnectionResponseFailed || !strings.Contains(response.Reason, "unsupported protocol version") {
+		t.Fatalf("expected a version rejection, got %+v", response)
+	}
+}
+
+func listenRaw(t *testing.T, address string) net.PacketConn {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", address)
+	if err != nil {
+		t.Skipf("address %v unavailable: %v", address, err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+func expectResponse(t *testing.T, conn net.PacketConn, addr net.Addr, connectionID protocol.ConnectionID, reason string) {
+	t.Helper()
+	writeRaw(t, conn, addr, connectionID, 1, &frame.ConnectionRequest{Version: protocol.Version})
+	response := readRaw[*frame.ConnectionResponse](t, conn)
+	if reason == "" && response.Response != frame.ConnectionResponseSuccess {
+		t.Fatalf("expected the connection to be accepted, got %+v", response)
+	}
+
+	if reason != "" && (response.Response != frame.ConnectionResponseFailed || response.Reason != reason) {
+		t.Fatalf("expected a rejection with %q, got %+v", reason, response)
+	}
+}
+
+func TestListenerMaxConnectionsPerIP(t *testing.T) {
+	listener, err := ListenConfig("127.0.0.1:0", &Config{MaxConnectionsPerIP: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	expectResponse(t, listenRaw(t, "127.0.0.1:0"), listener.Addr(), -1, "")
+	expectResponse(t, listenRaw(t, "127.0.0.1:0"), listener.Addr(), -2, "too many connections from address")
+	expectResponse(t, listenRaw(t, "127.0.0.2:0"), listener.Addr(), -3, "")
+}
+
+func TestListenerMaxConnectionsPerSubnet(t *testing.T) {
+	listener, err := ListenConfig("127.0.0.1:0", &Config{MaxConnectionsPerSubnet: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	expectResponse(t, listenRaw(t, "127.0.0.1:0"), listener.Addr(), -1, "")
+	expectResponse(t, listenRaw(t, "127.0.0.2:0"), listener.Addr(), -2, "too many connections from subnet")
+}
+
+func TestListenerAdmitAddress(t *testing.T) {
+	admitted := false
+	listener, err := ListenConfig("127.0.0.1:0", &Config{
+		AdmitAddress: func(_ net.Addr) error { return errors.New("blocked") },
+		AdmitConnection: func(_ net.Addr, _ HandshakeParameters) error {
+			admitted = true
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	expectResponse(t, listenRaw(t, "127.0.0.1:0"), listener.Addr(), -1, "blocked")
+	if admitted {
+		t.Fatal("expected the address stage to reject before the handshake parameters are checked")
+	}
+}
+
+func TestListenerAdmitConnectionDoesNotBlockReads(t *testing.T) {
+	release := make(chan struct{})
+	called := make(chan struct{})
+	var calls atomic.Int32
+	listener, err := ListenConfig("127.0.0.1:0", &Config{
+		AdmitConnection: func(_ net.Addr, _ HandshakeParameters) error {
+			if calls.Add(1) == 1 {
+				close(called)
+				<-release
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	defer close(release)
+
+	slow := listenRaw(t, "127.0.0.1:0")
+	writeRaw(t, slow, listener.Addr(), -1, 1, &frame.ConnectionRequest{Version: protocol.Version})
+	select {
+	case <-called:
+	case <-time.After(time.Second * 5):
+		t.Fatal("admission callback was not called")
+	}
+	expectResponse(t, listenRaw(t, "127.0.0.1:0"), listener.Addr(), -2, "")
+}
+
+func TestListenerAdmissionQueueFull(t *testing.T) {
+	release := make(chan struct{})
+	var calls atomic.Int32
+	config, err := populateConfig(&Config{
+		AdmitConnection: func(_ net.Addr, _ HandshakeParameters) error {
+			calls.Add(1)
+			<-release
+			return errors.New("refused")
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	generator := newGeneratorPacketConn()
+	conn, err := newUDPConn(generator, true, config.MaxUDPPayloadSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listener := newListener([]*udpConn{conn}, config, false)
+	go listener.shards[0].read()
+	defer listener.Close()
+
+	limit := admissionWorkers + admissionQueueLength
+	for i := range limit * 2 {
+		generator.send(-protocol.ConnectionID(i+1), 1, &frame.ConnectionRequest{Version: protocol.Version})
+	}
+	generator.send(0, 1, &frame.Ping{})
+
+	shard := listener.shards[0]
+	shard.mu.Lock()
+	pending := len(shard.pending)
+	shard.mu.Unlock()
+	if pending > limit {
+		t.Fatalf("expected at most %v pending handshakes, got %v", limit, pending)
+	}
+
+	close(release)
+	deadline := time.After(time.Second * 5)
+	for pending > 0 {
+		select {
+		case <-deadline:
+			t.Fatalf("admission workers did not drain, %v handshakes pending", pending)
+		case <-time.After(time.Millisecond * 10):
+		}
+		shard.mu.Lock()
+		pending = len(shard.pending)
+		shard.mu.Unlock()
+	}
+
+	if n := int(calls.Load()); n > limit {
+		t.Fatalf("expected requests beyond the admission queue to be dropped, got %v callbacks", n)
+	}
+}
+
+func TestListenerAcceptQueueFull(t *testing.T) {
+	listener, err := ListenConfig("127.0.0.1:0", &Config{AcceptQueueLength: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	expectResponse(t, listenRaw(t, "127.0.0.1:0"), listener.Addr(), -1, "")
+	expectResponse(t, listenRaw(t, "127.0.0.1:0"), listener.Addr(), -2, "accept queue full")
+	if refused := listener.Metrics().RefusedConnections; refused != 1 {
+		t.Fatalf("expected 1 refused connection, got %v", refused)
+	}
+}
+
+func TestListenerDuplicateConnectionRequest(t *testing.T) {
+	listener, err := Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	conn := listenRaw(t, "127.0.0.1:0")
+	writeRaw(t, conn, listener.Addr(), -1, 1, &frame.ConnectionRequest{Version: protocol.Version, Parameters: frame.TransportParameters{MaxStreams: 1}})
+	if response := readRaw[*frame.ConnectionResponse](t, conn); response.Response != frame.ConnectionResponseSuccess {
+		t.Fatalf("expected the connection to be accepted, got %+v", response)
+	}
+
+	writeRaw(t, conn, listener.Addr(), -1, 2, &frame.ConnectionRequest{Version: protocol.Version, Parameters: frame.TransportParameters{MaxStreams: 2}})
+	for readRaw[*frame.Acknowledgement](t, conn).Max < 2 {
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	server, err := listener.Accept(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if parameters := server.(*ServerConnection).peerParameters.Load(); parameters.MaxStreams != 1 {
+		t.Fatalf("expected a duplicate request not to renegotiate, got %+v", parameters)
+	}
+}
+
+func TestListenerStreamAcceptQueueFull(t *testing.T) {
+	listener, err := ListenConfig("127.0.0.1:0", &Config{StreamAcceptQueueLength: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	conn := listenRaw(t, "127.0.0.1:0")
+	writeRaw(t, conn, listener.Addr(), -1, 1, &frame.ConnectionRequest{Version: protocol.Version})
+	response := readRaw[*frame.ConnectionResponse](t, conn)
+	if response.Response != frame.ConnectionResponseSuccess {
+		t.Fatalf("expected the connection to be accepted, got %+v", response)
+	}
+
+	writeRaw(t, conn, listener.Addr(), response.ConnectionID, 2, &frame.StreamRequest{StreamID: 0})
+	writeRaw(t, conn, listener.Addr(), response.ConnectionID, 3, &frame.StreamRequest{StreamID: 1})
+	refused := readRaw[*frame.StreamResponse](t, conn)
+	if refused.StreamID != 1 || refused.Response != frame.StreamResponseFailed {
+		t.Fatalf("expected stream 1 to be refused, got %+v", refused)
+	}
+
+	if refused := listener.Metrics().RefusedStreams; refused != 1 {
+		t.Fatalf("expected 1 refused stream, got %v", refused)
+	}
+}
+
+func TestListenerRoutesAcrossShards(t *testing.T) {
+	config, err := populateConfig(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var generators [2]*generatorPacketConn
+	conns := make([]*udpConn, 0, len(generators))
+	for i := range generators {
+		generators[i] = newGeneratorPacketConn()
+		conn, err := newUDPConn(generators[i], true, config.MaxUDPPayloadSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conns = append(conns, conn)
+	}
+
+	listener := newListener(conns, config, false)
+	for _, shard := range listener.shards {
+		go shard.read()
+	}
+	defer listener.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	generators[0].send(-1, 1, &frame.ConnectionRequest{Version: protocol.Version})
+	c, err := listener.Accept(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	connectionID := protocol.ConnectionID(c.(*ServerConnection).connectionID.Load())
+	if shard := listener.shard(connectionID); shard.index != 0 {
+		t.Fatalf("expected shard 0 to own connection %v, got shard %v", connectionID, shard.index)
+	}
+
+	generators[1].send(connectionID, 2, &frame.StreamRequest{StreamID: 0})
+	if _, err := c.AcceptStream(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestListenerConnectionIDs(t *testing.T) {
+	config, err := populateConfig(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conns := make([]*udpConn, 3)
+	for i := range conns {
+		if conns[i], err = newUDPConn(&discardPacketConn{closed: make(chan struct{})}, true, config.MaxUDPPayloadSize); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	listener := newListener(conns, config, true)
+	seen := make(map[protocol.ConnectionID]bool)
+	for _, shard := range listener.shards {
+		for range 64 {
+			connectionID := shard.nextConnectionID()
+			if connectionID < 0 || listener.shard(connectionID) != shard {
+				t.Fatalf("connection id %v does not map back to shard %v", connectionID, shard.index)
+			}
+
+			if seen[connectionID] || connectionID < 1<<32 {
+				t.Fatalf("connection id %v is predictable", connectionID)
+			}
+			seen[connectionID] = true
+		}
+	}
+}
+
+func benchmarkListenerReceive(b *testing.B, size int) {
+	conn := newGeneratorPacketConn()
+	listener, err := ListenPacketConn(conn, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { _ = listener.Close() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	conn.send(-2, 1, &frame.ConnectionRequest{Version: protocol.Version})
+	c, err := listener.Accept(ctx)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	connectionID := protocol.ConnectionID(c.(*ServerConnection).connectionID.Load())
+	conn.send(connectionID, 2, &frame.StreamRequest{StreamID: 1})
+	stream, err := c.AcceptStream(ctx)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	packets := b.N
+	expected := packets * size
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		buf := make([]byte, 64*1024)
+		for received := 0; received < expected; {
+			n, err := stream.Read(buf)
+			if err != nil {
+				return
+			}
+			received += n
+		}
+	}()
+
+	payload := make([]byte, size)
+	fr := &frame.StreamData{StreamID: 1, Payload: payload}
+	i := 0
+	b.SetBytes(int64(size))
+	b.ReportAllocs()
+	b.ResetTimer()
+	conn.generators <- func(p []byte) int {
+		if i == packets {
+			return 0
+		}
+		fr.SequenceID = uint32(i)
+		i++
+		return len(frame.Append(frame.AppendHeader(p[:0], connectionID, uint32(i+2)), fr))
+	}
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		b.Fatal("timed out waiting for the stream to drain")
+	}
+	b.StopTimer()
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "packets/s")
+}
+
+func BenchmarkListenerReceive(b *testing.B) {
+	b.Run("64B", func(b *testing.B) { benchmarkListenerReceive(b, 64) })
+	b.Run("1200B", func(b *testing.B) { benchmarkListenerReceive(b, 1200) })
+}
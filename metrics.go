@@ -0,0 +1,20 @@
+package spectral
+
+import "sync/atomic"
+
+type ListenerMetrics struct {
+	RefusedConnections uint64
+	RefusedStreams     uint64
+}
+
+type listenerMetrics struct {
+	refusedConnections atomic.Uint64
+	refusedStreams     atomic.Uint64
+}
+
+func (m *listenerMetrics) snapshot() ListenerMetrics {
+	return ListenerMetrics{
+		RefusedConnections: m.refusedConnections.Load(),
+		RefusedStreams:     m.refusedStreams.Load(),
+	}
+}
@@ -17,39 +17,66 @@ type mtuDiscovery struct {
 	mtuIncrease func(mtu uint64)
 	flight      int
 	current     uint64
+	low         uint64
+	high        uint64
 	discovered  bool
 	prev        time.Time
 }
 
-func newMTUDiscovery(now time.Time, mtuIncrease func(mtu uint64)) *mtuDiscovery {
+func newMTUDiscovery(now time.Time, maxPacketSize uint64, mtuIncrease func(mtu uint64)) *mtuDiscovery {
 	m := &mtuDiscovery{
 		mtuIncrease: mtuIncrease,
 		current:     protocol.MinPacketSize,
+		low:         protocol.MinPacketSize,
+		high:        maxPacketSize,
 		prev:        now,
 	}
 	m.discover()
 	return m
 }
 
+func (m *mtuDiscovery) setCeiling(high uint64) {
+	if high >= m.high {
+		return
+	}
+
+	m.high = max(high, m.low)
+	if m.current > m.high {
+		m.current = m.low
+		m.discover()
+	}
+}
+
 func (m *mtuDiscovery) onAck(mtu uint64) {
 	if m.current != mtu || m.mtuIncrease == nil {
 		return
 	}
 
+	m.low = m.current
 	m.mtuIncrease(m.current)
 	if !m.discovered {
 		m.discover()
 	}
 }
 
+func (m *mtuDiscovery) next(rtt time.Duration) (t time.Time) {
+	if !m.discovered {
+		return m.prev.Add(rtt * probeDelay)
+	}
+	return
+}
+
 func (m *mtuDiscovery) sendProbe(now time.Time, rtt time.Duration) bool {
 	if now.Sub(m.prev) < rtt*probeDelay {
 		return false
 	}
 
 	if m.flight >= probeAttempts {
-		m.discovered = true
-		return false
+		m.high = m.current - 1
+		m.discover()
+		if m.discovered {
+			return false
+		}
 	}
 	m.flight++
 	m.prev = now
@@ -57,10 +84,18 @@ func (m *mtuDiscovery) sendProbe(now time.Time, rtt time.Duration) bool {
 }
 
 func (m *mtuDiscovery) discover() {
-	if m.current >= protocol.MaxPacketSize {
+	if m.low >= m.high {
+		m.discovered = true
+		return
+	}
+
+	if m.current == m.low && m.low == protocol.MinPacketSize {
+		m.current = m.high
+	} else if m.high-m.low < mtuDiff {
 		m.discovered = true
 		return
+	} else {
+		m.current = m.low + (m.high-m.low+1)/2
 	}
 	m.flight = 0
-	m.current = min(m.current+mtuDiff, protocol.MaxPacketSize)
 }
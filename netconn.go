@@ -0,0 +1,233 @@
+package spectral
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"github.com/cooldogedev/spectral/internal/frame"
+)
+
+var _ net.Conn = &streamConn{}
+
+type streamConn struct {
+	*Stream
+	conn   Connection
+	closed atomic.Bool
+}
+
+func NewConn(conn Connection, stream *Stream) net.Conn {
+	return &streamConn{Stream: stream, conn: conn}
+}
+
+func (s *streamConn) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	n, err := s.Stream.Read(p)
+	if err != nil && !s.closed.Load() && errors.Is(err, errStreamClosedByPeer) {
+		return n, io.EOF
+	}
+	return n, s.translate(err)
+}
+
+func (s *streamConn) Write(p []byte) (int, error) {
+	n, err := s.Stream.Write(p)
+	return n, s.translate(err)
+}
+
+func (s *streamConn) Close() error {
+	if s.closed.Swap(true) {
+		return net.ErrClosed
+	}
+	return s.Stream.Close()
+}
+
+func (s *streamConn) LocalAddr() net.Addr {
+	return s.conn.LocalAddr()
+}
+
+func (s *streamConn) RemoteAddr() net.Addr {
+	return s.conn.RemoteAddr()
+}
+
+func (s *streamConn) translate(err error) error {
+	switch {
+	case err == nil || errors.Is(err, os.ErrDeadlineExceeded):
+		return err
+	case s.closed.Load():
+		return net.ErrClosed
+	default:
+		return err
+	}
+}
+
+var _ net.Listener = &streamListener{}
+
+type streamListener struct {
+	listener   *Listener
+	streams    chan net.Conn
+	ctx        context.Context
+	cancelFunc context.CancelFunc
+	once       sync.Once
+}
+
+func NewNetListener(listener *Listener) net.Listener {
+	l := &streamListener{
+		listener: listener,
+		streams:  make(chan net.Conn, listener.config.StreamAcceptQueueLength),
+	}
+	l.ctx, l.cancelFunc = context.WithCancel(listener.ctx)
+	go l.acceptConnections()
+	return l
+}
+
+func (l *streamListener) Accept() (net.Conn, error) {
+	select {
+	case <-l.ctx.Done():
+		return nil, net.ErrClosed
+	case conn := <-l.streams:
+		return conn, nil
+	}
+}
+
+func (l *streamListener) Addr() net.Addr {
+	return l.listener.Addr()
+}
+
+func (l *streamListener) Close() (err error) {
+	l.once.Do(func() {
+		l.cancelFunc()
+		err = l.listener.Close()
+	})
+	return
+}
+
+func (l *streamListener) acceptConnections() {
+	for {
+		conn, err := l.listener.Accept(l.ctx)
+		if err != nil {
+			return
+		}
+		go l.acceptStreams(conn)
+	}
+}
+
+func (l *streamListener) acceptStreams(conn Connection) {
+	for {
+		stream, err := conn.AcceptStream(l.ctx)
+		if err != nil {
+			return
+		}
+
+		select {
+		case l.streams <- NewConn(conn, stream):
+		case <-l.ctx.Done():
+			_ = stream.Close()
+			return
+		}
+	}
+}
+
+type dialerEntry struct {
+	conn  Connection
+	err   error
+	ready chan struct{}
+}
+
+func (e *dialerEntry) usable() bool {
+	if e.err != nil || e.conn.Context().Err() != nil {
+		return false
+	}
+
+	select {
+	case <-e.conn.GoingAway():
+		return false
+	default:
+		return true
+	}
+}
+
+type Dialer struct {
+	Config *Config
+	conns  map[string]*dialerEntry
+	mu     sync.Mutex
+}
+
+func (d *Dialer) DialContext(ctx context.Context, _, address string) (net.Conn, error) {
+	entry, err := d.connection(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+
+	stream, err := entry.conn.OpenStream(ctx)
+	if err != nil {
+		if !entry.usable() {
+			d.evict(address, entry)
+		}
+		return nil, err
+	}
+	return NewConn(entry.conn, stream), nil
+}
+
+func (d *Dialer) Close() error {
+	d.mu.Lock()
+	conns := d.conns
+	d.conns = nil
+	d.mu.Unlock()
+	for _, entry := range conns {
+		<-entry.ready
+		if entry.conn != nil {
+			_ = entry.conn.CloseWithError(frame.ConnectionCloseGraceful, "closed dialer")
+		}
+	}
+	return nil
+}
+
+func (d *Dialer) connection(ctx context.Context, address string) (*dialerEntry, error) {
+	for {
+		d.mu.Lock()
+		if d.conns == nil {
+			d.conns = make(map[string]*dialerEntry)
+		}
+
+		entry, ok := d.conns[address]
+		if !ok {
+			entry = &dialerEntry{ready: make(chan struct{})}
+			d.conns[address] = entry
+			d.mu.Unlock()
+			entry.conn, entry.err = DialConfig(ctx, address, d.Config)
+			close(entry.ready)
+			if entry.err != nil {
+				d.evict(address, entry)
+				return nil, entry.err
+			}
+			return entry, nil
+		}
+		d.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, context.Cause(ctx)
+		case <-entry.ready:
+		}
+
+		if entry.usable() {
+			return entry, nil
+		}
+		d.evict(address, entry)
+	}
+}
+
+func (d *Dialer) evict(address string, entry *dialerEntry) {
+	d.mu.Lock()
+	if d.conns[address] == entry {
+		delete(d.conns, address)
+	}
+	d.mu.Unlock()
+}
@@ -0,0 +1,165 @@
+package spectral
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newNetListener(t *testing.T) net.Listener {
+	listener, err := Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l := NewNetListener(listener)
+	t.Cleanup(func() { _ = l.Close() })
+	return l
+}
+
+func TestNetHTTPRoundTrip(t *testing.T) {
+	l := newNetListener(t)
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		_, _ = io.WriteString(w, r.URL.Path+":"+string(body))
+	})}
+	go func() { _ = server.Serve(l) }()
+	t.Cleanup(func() { _ = server.Close() })
+
+	dialer := &Dialer{}
+	t.Cleanup(func() { _ = dialer.Close() })
+	client := &http.Client{Transport: &http.Transport{DialContext: dialer.DialContext}, Timeout: time.Second * 5}
+	for i, body := range []string{"hello", strings.Repeat("x", 64*1024)} {
+		response, err := client.Post("http://"+l.Addr().String()+"/echo", "text/plain", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		received, err := io.ReadAll(response.Body)
+		_ = response.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected := "/echo:" + body; string(received) != expected {
+			t.Fatalf("request %v: expected %v bytes, got %v", i, len(expected), len(received))
+		}
+	}
+
+	dialer.mu.Lock()
+	pooled := len(dialer.conns)
+	dialer.mu.Unlock()
+	if pooled != 1 {
+		t.Fatalf("expected requests to share a single pooled connection, got %v", pooled)
+	}
+}
+
+func TestNetConnStreamsAcrossConnections(t *testing.T) {
+	l := newNetListener(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	var conns []net.Conn
+	for range 2 {
+		conn, err := Dial(ctx, l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = conn.CloseWithError(0, "") })
+
+		stream, err := conn.OpenStream(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := NewConn(conn, stream)
+		if _, err := c.Write([]byte("x")); err != nil {
+			t.Fatal(err)
+		}
+		conns = append(conns, c)
+	}
+
+	for range conns {
+		accepted, err := l.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if accepted.LocalAddr().String() != l.Addr().String() {
+			t.Fatalf("expected local address %v, got %v", l.Addr(), accepted.LocalAddr())
+		}
+
+		_ = accepted.SetReadDeadline(time.Now().Add(time.Second))
+		if _, err := io.ReadFull(accepted, make([]byte, 1)); err != nil {
+			t.Fatal(err)
+		}
+		_ = accepted.Close()
+	}
+
+	for _, c := range conns {
+		_ = c.SetReadDeadline(time.Now().Add(time.Second))
+		if _, err := c.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+			t.Fatalf("expected EOF after the peer closed the stream, got %v", err)
+		}
+
+		if _, err := c.Write([]byte("x")); err == nil || errors.Is(err, io.EOF) {
+			t.Fatalf("expected a write after the peer closed the stream to fail without EOF, got %v", err)
+		}
+		_ = c.Close()
+		if _, err := c.Read(make([]byte, 1)); !errors.Is(err, net.ErrClosed) {
+			t.Fatalf("expected a closed connection error, got %v", err)
+		}
+	}
+
+	_ = l.Close()
+	if _, err := l.Accept(); !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("expected a closed listener error, got %v", err)
+	}
+}
+
+func TestNetConnConnectionClosed(t *testing.T) {
+	l := newNetListener(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	conn, err := Dial(ctx, l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stream, err := conn.OpenStream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewConn(conn, stream)
+	_ = conn.CloseWithError(0, "")
+	if _, err := c.Read(make([]byte, 1)); err == nil || errors.Is(err, io.EOF) {
+		t.Fatalf("expected a read on a closed connection to fail without EOF, got %v", err)
+	}
+
+	if _, err := c.Write([]byte("x")); err == nil || errors.Is(err, io.EOF) {
+		t.Fatalf("expected a write on a closed connection to fail without EOF, got %v", err)
+	}
+}
+
+func TestNetConnDeadline(t *testing.T) {
+	l := newNetListener(t)
+	dialer := &Dialer{}
+	t.Cleanup(func() { _ = dialer.Close() })
+	c, err := dialer.DialContext(context.Background(), "udp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	_ = c.SetReadDeadline(time.Now().Add(time.Millisecond * 20))
+	_, err = c.Read(make([]byte, 1))
+	var netErr net.Error
+	if !errors.Is(err, os.ErrDeadlineExceeded) || !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Fatalf("expected a timeout error, got %v", err)
+	}
+}
@@ -0,0 +1,88 @@
+package spectral
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/cooldogedev/spectral/internal/protocol"
+)
+
+var (
+	packetPools   = make(map[int]*packetPool)
+	packetPoolsMu sync.Mutex
+
+	receivedPacketPool = sync.Pool{
+		New: func() any {
+			return &receivedPacket{}
+		},
+	}
+)
+
+type packetPool struct {
+	size int
+	pool sync.Pool
+}
+
+func newPacketPool(maxPacketSize uint64) *packetPool {
+	size := protocol.PacketHeaderSize + int(maxPacketSize)
+	packetPoolsMu.Lock()
+	defer packetPoolsMu.Unlock()
+	if p, ok := packetPools[size]; ok {
+		return p
+	}
+
+	p := &packetPool{size: size}
+	p.pool.New = func() any {
+		return &packet{b: make([]byte, 0, size), pool: p}
+	}
+	packetPools[size] = p
+	return p
+}
+
+func (p *packetPool) get() *packet {
+	pk := p.pool.Get().(*packet)
+	pk.b = pk.b[:0]
+	return pk
+}
+
+type packet struct {
+	b       []byte
+	streams []streamCredit
+	pool    *packetPool
+}
+
+func (p *packet) release() {
+	for _, c := range p.streams {
+		c.queue.credit(c.n)
+	}
+	clear(p.streams)
+	p.streams = p.streams[:0]
+	if cap(p.b) == p.pool.size {
+		p.b = p.b[:0]
+		p.pool.pool.Put(p)
+	}
+}
+
+type receivedPacket struct {
+	dgram      *datagram
+	addr       net.Addr
+	sequenceID uint32
+	t          time.Time
+}
+
+func newReceivedPacket(dgram *datagram, sequenceID uint32, t time.Time) *receivedPacket {
+	pk := receivedPacketPool.Get().(*receivedPacket)
+	*pk = receivedPacket{dgram: dgram, addr: dgram.peerAddr, sequenceID: sequenceID, t: t}
+	return pk
+}
+
+func (p *receivedPacket) frames() []byte {
+	return p.dgram.b[protocol.PacketHeaderSize:]
+}
+
+func (p *receivedPacket) release() {
+	p.dgram.reset()
+	*p = receivedPacket{}
+	receivedPacketPool.Put(p)
+}
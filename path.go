@@ -0,0 +1,61 @@
+package spectral
+
+import (
+	"crypto/rand"
+	"net"
+	"time"
+
+	"github.com/cooldogedev/spectral/internal/congestion"
+	"github.com/cooldogedev/spectral/internal/frame"
+)
+
+const (
+	pathProbeInterval     = time.Millisecond * 200
+	pathMigrationInterval = time.Second
+)
+
+type pathChallenge struct {
+	addr net.Addr
+	data [8]byte
+	sent time.Time
+}
+
+func newPathChallenge(addr net.Addr) *pathChallenge {
+	p := &pathChallenge{addr: addr}
+	_, _ = rand.Read(p.data[:])
+	return p
+}
+
+func (c *connection) probePath(now time.Time, addr net.Addr) error {
+	if now.Sub(c.pathMigrated) < pathMigrationInterval {
+		return nil
+	}
+
+	if c.path == nil || !addrEqual(c.path.addr, addr) {
+		c.path = newPathChallenge(addr)
+	} else if now.Sub(c.path.sent) < c.rtt.RTO() {
+		return nil
+	}
+	c.path.sent = now
+	c.logger.Log("path_challenge", "addr", addr.String())
+	return c.writePath(c.conn.Load(), addr, &frame.PathChallenge{Data: c.path.data})
+}
+
+func (c *connection) validatePath(now time.Time, data [8]byte) {
+	if c.path == nil || c.path.data != data {
+		return
+	}
+
+	prev := c.peerAddr.Swap(c.path.addr).(net.Addr)
+	c.sender.Reset(c.logger, now)
+	c.rtt = congestion.NewRTT()
+	c.pathMigrated = now
+	c.logger.Log("path_migrated", "prev", prev.String(), "new", c.path.addr.String())
+	c.path = nil
+}
+
+func (c *connection) writePath(conn *udpConn, addr net.Addr, fr frame.Frame) (err error) {
+	pk := frame.Pack(c.destinationID(), 0, frame.PackSingle(fr))
+	_, err = conn.Write(pk, addr)
+	return
+}
@@ -0,0 +1,224 @@
+package spectral
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cooldogedev/spectral/internal/frame"
+	"github.com/cooldogedev/spectral/internal/log"
+	"github.com/cooldogedev/spectral/spectraltest"
+)
+
+type rebindingConn struct {
+	conns    [2]net.PacketConn
+	active   atomic.Int32
+	received chan rebindingPacket
+}
+
+type rebindingPacket struct {
+	b    []byte
+	addr net.Addr
+}
+
+func newRebindingConn(t *testing.T) *rebindingConn {
+	c := &rebindingConn{received: make(chan rebindingPacket, 256)}
+	for i := range c.conns {
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.conns[i] = conn
+		go func() {
+			for {
+				b := make([]byte, 1500)
+				n, addr, err := conn.ReadFrom(b)
+				if err != nil {
+					return
+				}
+				c.received <- rebindingPacket{b[:n], addr}
+			}
+		}()
+	}
+	return c
+}
+
+func (c *rebindingConn) rebind() {
+	c.active.Store(1)
+}
+
+func (c *rebindingConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	pk, ok := <-c.received
+	if !ok {
+		return 0, nil, net.ErrClosed
+	}
+	return copy(p, pk.b), pk.addr, nil
+}
+
+func (c *rebindingConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	return c.conns[c.active.Load()].WriteTo(p, addr)
+}
+
+func (c *rebindingConn) Close() error {
+	for _, conn := range c.conns {
+		_ = conn.Close()
+	}
+	return nil
+}
+
+func (c *rebindingConn) LocalAddr() net.Addr {
+	return c.conns[c.active.Load()].LocalAddr()
+}
+
+func (c *rebindingConn) SetDeadline(time.Time) error {
+	return nil
+}
+
+func (c *rebindingConn) SetReadDeadline(time.Time) error {
+	return nil
+}
+
+func (c *rebindingConn) SetWriteDeadline(time.Time) error {
+	return nil
+}
+
+func acceptStream(t *testing.T, ctx context.Context, listener *Listener, client Connection) (server Connection, serverStream *Stream, clientStream *Stream) {
+	t.Helper()
+	server, err := listener.Accept(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	accepted := make(chan *Stream, 1)
+	go func() {
+		stream, _ := server.AcceptStream(ctx)
+		accepted <- stream
+	}()
+
+	if clientStream, err = client.OpenStream(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if serverStream = <-accepted; serverStream == nil {
+		t.Fatal("failed to accept stream")
+	}
+	return
+}
+
+func waitForPath(t *testing.T, ctx context.Context, server Connection, serverStream *Stream, clientStream *Stream, migrated func(addr net.Addr) bool) {
+	t.Helper()
+	for {
+		if _, err := clientStream.Write([]byte("x")); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := io.ReadFull(serverStream, make([]byte, 1)); err != nil {
+			t.Fatal(err)
+		}
+
+		if migrated(server.RemoteAddr()) {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			t.Fatalf("server did not validate the new path, still at %v", server.RemoteAddr())
+		case <-time.After(time.Millisecond * 20):
+		}
+	}
+}
+
+func TestConnectionMigration(t *testing.T) {
+	listener, err := Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	conn, err := Dial(ctx, listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.CloseWithError(0, "")
+
+	server, serverStream, clientStream := acceptStream(t, ctx, listener, conn)
+	if err := conn.(*ClientConnection).Migrate(ctx, "127.0.0.2:0"); err != nil {
+		t.Skipf("second loopback address unavailable: %v", err)
+	}
+
+	if host := conn.(*ClientConnection).LocalAddr().(*net.UDPAddr).IP.String(); host != "127.0.0.2" {
+		t.Fatalf("expected the client to bind 127.0.0.2, got %v", host)
+	}
+	waitForPath(t, ctx, server, serverStream, clientStream, func(addr net.Addr) bool {
+		return addr.(*net.UDPAddr).IP.String() == "127.0.0.2"
+	})
+}
+
+func TestConnectionNATRebinding(t *testing.T) {
+	listener, err := Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	packetConn := newRebindingConn(t)
+	defer packetConn.Close()
+	conn, err := DialPacketConn(ctx, packetConn, listener.Addr(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.CloseWithError(0, "")
+
+	server, serverStream, clientStream := acceptStream(t, ctx, listener, conn)
+	packetConn.rebind()
+	waitForPath(t, ctx, server, serverStream, clientStream, func(addr net.Addr) bool {
+		return addr.String() == packetConn.LocalAddr().String()
+	})
+
+	if _, err := serverStream.Write([]byte("y")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := io.ReadFull(clientStream, make([]byte, 1)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConnectionMigrationRequiresNewerPacket(t *testing.T) {
+	c, _, now := newSendBenchmark(t)
+	c.perspective = log.PerspectiveServer
+	receive := func(addr net.Addr, sequenceID uint32, fr frame.Frame) {
+		receiveFrames(t, c, now, addr, sequenceID, frame.PackSingle(fr))
+	}
+
+	peer, attacker := c.RemoteAddr(), spectraltest.Addr("attacker")
+	receive(peer, 3, &frame.Ping{})
+	receive(attacker, 0, &frame.Ping{})
+	receive(attacker, 4, &frame.PathChallenge{})
+	receive(attacker, 2, &frame.Ping{})
+	if c.path != nil {
+		t.Fatal("expected unsequenced, probing and stale packets not to start a migration")
+	}
+
+	receive(attacker, 5, &frame.Ping{})
+	if c.path == nil {
+		t.Fatal("expected a newer non-probing packet to start a migration")
+	}
+
+	receive(attacker, 0, &frame.PathResponse{Data: c.path.data})
+	if !addrEqual(c.RemoteAddr(), attacker) {
+		t.Fatalf("expected the path to be validated, still at %v", c.RemoteAddr())
+	}
+
+	receive(peer, 6, &frame.Ping{})
+	if c.path != nil {
+		t.Fatal("expected path switches to be rate limited")
+	}
+}
@@ -2,6 +2,7 @@ package spectral
 
 type receiveQueue struct {
 	expected uint32
+	largest  uint32
 	queue    map[uint32]bool
 }
 
@@ -17,6 +18,7 @@ func (r *receiveQueue) add(sequenceID uint32) bool {
 		return false
 	}
 	r.queue[sequenceID] = true
+	r.largest = max(r.largest, sequenceID)
 	r.merge()
 	return true
 }
@@ -1,102 +1,209 @@
 package spectral
 
 import (
-	"slices"
 	"sync"
 	"time"
+
+	"github.com/cooldogedev/spectral/internal/protocol"
 )
 
-const retransmissionAttempts = 3
+const (
+	retransmissionAttempts       = 3
+	retransmissionInitialEntries = 64
+)
 
 type retransmissionEntry struct {
 	sequenceID uint32
-	payload    []byte
+	pk         *packet
+	size       uint64
+	sent       time.Time
+	attempts   int
+}
+
+type retransmissionDeadline struct {
+	sequenceID uint32
 	sent       time.Time
 	attempts   int
 }
 
 type retransmissionQueue struct {
-	queue []*retransmissionEntry
-	mu    sync.RWMutex
+	entries   []retransmissionEntry
+	base      uint32
+	end       uint32
+	count     int
+	deadlines []retransmissionDeadline
+	head      int
+	mu        sync.RWMutex
 }
 
 func newRetransmissionQueue() *retransmissionQueue {
 	return &retransmissionQueue{}
 }
 
-func (r *retransmissionQueue) add(now time.Time, sequenceID uint32, p []byte) {
+func (r *retransmissionQueue) add(now time.Time, sequenceID uint32, pk *packet) {
 	r.mu.Lock()
-	r.queue = append(r.queue, &retransmissionEntry{sequenceID: sequenceID, payload: p, sent: now})
-	r.sort()
+	if r.count == 0 {
+		r.base, r.end = sequenceID, sequenceID+1
+	} else {
+		r.base, r.end = min(r.base, sequenceID), max(r.end, sequenceID+1)
+	}
+	r.reserve(int(r.end - r.base))
+	r.entries[r.index(sequenceID)] = retransmissionEntry{sequenceID: sequenceID, pk: pk, size: uint64(len(pk.b) - protocol.PacketHeaderSize), sent: now}
+	r.count++
+	r.schedule(retransmissionDeadline{sequenceID: sequenceID, sent: now})
 	r.mu.Unlock()
 }
 
-func (r *retransmissionQueue) remove(sequenceID uint32) *retransmissionEntry {
+func (r *retransmissionQueue) remove(sequenceID uint32) (entry retransmissionEntry, ok bool) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	index := slices.IndexFunc(r.queue, func(e *retransmissionEntry) bool { return e.sequenceID == sequenceID })
-	if index >= 0 {
-		entry := r.queue[index]
-		r.queue = slices.Delete(r.queue, index, index+1)
-		return entry
+	if e := r.lookup(sequenceID); e != nil {
+		entry = *e
+		entry.pk.release()
+		entry.pk = nil
+		r.delete(e)
+		r.prune()
+		return entry, true
+	}
+	return
+}
+
+func (r *retransmissionQueue) bounds(first, last uint32) (from, to uint32) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.count == 0 || last < r.base || first >= r.end {
+		return
 	}
-	return nil
+	return max(first, r.base), uint32(min(uint64(last)+1, uint64(r.end)))
+}
+
+func (r *retransmissionQueue) len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.count
 }
 
 func (r *retransmissionQueue) next(rto time.Duration) (t time.Time) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
-	if len(r.queue) > 0 {
-		return r.queue[0].sent.Add(rto)
+	if r.head < len(r.deadlines) {
+		return r.deadlines[r.head].sent.Add(rto)
 	}
 	return
 }
 
-func (r *retransmissionQueue) shift(now time.Time, rto time.Duration) (p []byte, t time.Time) {
+func (r *retransmissionQueue) shift(now time.Time, rto time.Duration) (pk *packet, t time.Time, dropped bool) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	if len(r.queue) == 0 {
+	if r.head == len(r.deadlines) || now.Sub(r.deadlines[r.head].sent) < rto {
 		return
 	}
 
-	entry := r.queue[0]
-	if now.Sub(entry.sent) >= rto {
-		sent := entry.sent
-		entry.sent = now
-		entry.attempts++
-		if entry.attempts >= retransmissionAttempts {
-			r.queue[0] = nil
-			r.queue = r.queue[1:]
-		} else {
-			r.queue = append(r.queue[1:], entry)
-			r.sort()
-		}
-		return entry.payload, sent
+	deadline := r.deadlines[r.head]
+	r.head++
+	entry := r.lookup(deadline.sequenceID)
+	pk, t = entry.pk, entry.sent
+	entry.sent = now
+	entry.attempts++
+	if dropped = entry.attempts >= retransmissionAttempts; dropped {
+		r.delete(entry)
+	} else {
+		r.schedule(retransmissionDeadline{sequenceID: entry.sequenceID, sent: now, attempts: entry.attempts})
 	}
-	return
+	r.prune()
+	return pk, t, dropped
 }
 
 func (r *retransmissionQueue) clear() {
 	r.mu.Lock()
-	for i, entry := range r.queue {
-		entry.payload = entry.payload[:0]
-		entry.payload = nil
-		r.queue[i] = nil
+	for _, entry := range r.entries {
+		if entry.pk != nil {
+			entry.pk.release()
+		}
 	}
-	r.queue = r.queue[:0]
-	r.queue = nil
+	r.entries = nil
+	r.deadlines = nil
+	r.base, r.end, r.count, r.head = 0, 0, 0, 0
 	r.mu.Unlock()
 }
 
-func (r *retransmissionQueue) sort() {
-	if len(r.queue) > 1 {
-		slices.SortFunc(r.queue, func(a, b *retransmissionEntry) int {
-			if a.sent.Before(b.sent) {
-				return -1
-			} else if b.sent.Before(a.sent) {
-				return 1
-			}
-			return 0
-		})
+func (r *retransmissionQueue) index(sequenceID uint32) uint32 {
+	return sequenceID & uint32(len(r.entries)-1)
+}
+
+func (r *retransmissionQueue) lookup(sequenceID uint32) *retransmissionEntry {
+	if r.count == 0 || sequenceID < r.base || sequenceID >= r.end {
+		return nil
+	}
+
+	entry := &r.entries[r.index(sequenceID)]
+	if entry.pk == nil || entry.sequenceID != sequenceID {
+		return nil
+	}
+	return entry
+}
+
+func (r *retransmissionQueue) delete(entry *retransmissionEntry) {
+	*entry = retransmissionEntry{}
+	r.count--
+	if r.count == 0 {
+		r.base = r.end
+		return
+	}
+
+	for r.lookup(r.base) == nil {
+		r.base++
+	}
+
+	for r.lookup(r.end-1) == nil {
+		r.end--
+	}
+}
+
+func (r *retransmissionQueue) reserve(span int) {
+	if span <= len(r.entries) {
+		return
+	}
+
+	size := max(len(r.entries), retransmissionInitialEntries)
+	for size < span {
+		size *= 2
+	}
+
+	entries := r.entries
+	r.entries = make([]retransmissionEntry, size)
+	for _, entry := range entries {
+		if entry.pk != nil {
+			r.entries[r.index(entry.sequenceID)] = entry
+		}
+	}
+}
+
+func (r *retransmissionQueue) schedule(deadline retransmissionDeadline) {
+	i := len(r.deadlines)
+	r.deadlines = append(r.deadlines, deadline)
+	for i > r.head && r.deadlines[i-1].sent.After(deadline.sent) {
+		r.deadlines[i] = r.deadlines[i-1]
+		i--
+	}
+	r.deadlines[i] = deadline
+}
+
+func (r *retransmissionQueue) prune() {
+	for r.head < len(r.deadlines) {
+		deadline := r.deadlines[r.head]
+		if entry := r.lookup(deadline.sequenceID); entry != nil && entry.attempts == deadline.attempts {
+			break
+		}
+		r.head++
+	}
+
+	if r.head == len(r.deadlines) {
+		r.deadlines = r.deadlines[:0]
+		r.head = 0
+	} else if r.head > len(r.deadlines)/2 {
+		n := copy(r.deadlines, r.deadlines[r.head:])
+		r.deadlines = r.deadlines[:n]
+		r.head = 0
 	}
 }
@@ -0,0 +1,190 @@
+package spectral
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/cooldogedev/spectral/internal/protocol"
+)
+
+func testPacket(b byte) *packet {
+	pk := newPacketPool(protocol.MaxPacketSize).get()
+	pk.b = append(pk.b[:protocol.PacketHeaderSize], b)
+	return pk
+}
+
+func payloadOf(pk *packet) byte {
+	return pk.b[protocol.PacketHeaderSize]
+}
+
+func TestRetransmissionQueueRemove(t *testing.T) {
+	now := time.Now()
+	r := newRetransmissionQueue()
+	r.add(now, 1, testPacket(1))
+	r.add(now, 2, testPacket(2))
+	if entry, ok := r.remove(1); !ok || entry.sequenceID != 1 || entry.size != 1 {
+		t.Fatalf("expected entry 1, got %v", entry)
+	}
+
+	if _, ok := r.remove(1); ok {
+		t.Fatal("removed entry 1 twice")
+	}
+
+	if r.len() != 1 {
+		t.Fatalf("expected 1 entry, got %v", r.len())
+	}
+}
+
+func TestRetransmissionQueueNext(t *testing.T) {
+	now := time.Now()
+	r := newRetransmissionQueue()
+	if !r.next(time.Second).IsZero() {
+		t.Fatal("expected no deadline for an empty queue")
+	}
+
+	r.add(now.Add(time.Millisecond), 2, testPacket(2))
+	r.add(now, 1, testPacket(1))
+	if next := r.next(time.Second); !next.Equal(now.Add(time.Second)) {
+		t.Fatalf("expected deadline of the oldest entry, got %v", next.Sub(now))
+	}
+}
+
+func TestRetransmissionQueueShift(t *testing.T) {
+	now := time.Now()
+	rto := time.Millisecond * 100
+	r := newRetransmissionQueue()
+	r.add(now, 1, testPacket(1))
+	r.add(now.Add(time.Millisecond), 2, testPacket(2))
+	if pk, _, _ := r.shift(now.Add(rto/2), rto); pk != nil {
+		t.Fatal("shifted entry before its retransmission timeout")
+	}
+
+	pk, sent, dropped := r.shift(now.Add(rto), rto)
+	if pk == nil || payloadOf(pk) != 1 || !sent.Equal(now) || dropped {
+		t.Fatalf("expected entry 1 sent at %v, got %v sent at %v", now, pk, sent)
+	}
+
+	if r.len() != 2 {
+		t.Fatalf("expected shifted entry to be requeued, got %v entries", r.len())
+	}
+
+	if pk, _, _ := r.shift(now.Add(rto+time.Millisecond), rto); pk == nil || payloadOf(pk) != 2 {
+		t.Fatalf("expected entry 2 to be next, got %v", pk)
+	}
+}
+
+func TestRetransmissionQueueAttempts(t *testing.T) {
+	now := time.Now()
+	rto := time.Millisecond
+	r := newRetransmissionQueue()
+	r.add(now, 1, testPacket(1))
+	for i := range retransmissionAttempts {
+		now = now.Add(rto)
+		pk, _, dropped := r.shift(now, rto)
+		if pk == nil {
+			t.Fatalf("attempt %v was not retransmitted", i)
+		}
+
+		if dropped != (i == retransmissionAttempts-1) {
+			t.Fatalf("attempt %v reported dropped=%v", i, dropped)
+		}
+	}
+
+	if r.len() != 0 {
+		t.Fatal("entry was not dropped after the final attempt")
+	}
+}
+
+func TestRetransmissionQueueClear(t *testing.T) {
+	r := newRetransmissionQueue()
+	r.add(time.Now(), 1, testPacket(1))
+	r.clear()
+	if r.len() != 0 {
+		t.Fatal("queue not empty after clear")
+	}
+}
+
+func TestRetransmissionQueueGrowth(t *testing.T) {
+	now := time.Now()
+	r := newRetransmissionQueue()
+	for i := uint32(1000); i > 0; i-- {
+		r.add(now, i, testPacket(byte(i)))
+	}
+
+	for i := uint32(1); i <= 1000; i += 2 {
+		if entry, ok := r.remove(i); !ok || entry.sequenceID != i {
+			t.Fatalf("expected entry %v, got %v", i, entry)
+		}
+	}
+
+	if r.len() != 500 {
+		t.Fatalf("expected 500 entries, got %v", r.len())
+	}
+
+	if from, to := r.bounds(0, 2000); from != 2 || to != 1001 {
+		t.Fatalf("expected bounds [2, 1001), got [%v, %v)", from, to)
+	}
+}
+
+func TestRetransmissionQueueBounds(t *testing.T) {
+	r := newRetransmissionQueue()
+	if from, to := r.bounds(0, math.MaxUint32); from != to {
+		t.Fatalf("expected empty bounds for an empty queue, got [%v, %v)", from, to)
+	}
+
+	r.add(time.Now(), 10, testPacket(10))
+	r.add(time.Now(), 20, testPacket(20))
+	for _, test := range []struct{ first, last, from, to uint32 }{
+		{0, math.MaxUint32, 10, 21},
+		{12, 15, 12, 16},
+		{0, 9, 0, 0},
+		{21, 30, 0, 0},
+	} {
+		if from, to := r.bounds(test.first, test.last); from != test.from || to != test.to {
+			t.Fatalf("expected bounds [%v, %v) for [%v, %v], got [%v, %v)", test.from, test.to, test.first, test.last, from, to)
+		}
+	}
+}
+
+func benchmarkRetransmissionQueue(b *testing.B, lossInterval uint32) {
+	const window = 10_000
+	rto := time.Millisecond * 100
+	now := time.Now()
+	r := newRetransmissionQueue()
+	b.ReportAllocs()
+	b.ResetTimer()
+	sequenceID := uint32(1)
+	for range b.N {
+		for i := range uint32(window) {
+			r.add(now, sequenceID+i, testPacket(byte(i)))
+			now = now.Add(time.Microsecond)
+		}
+
+		for i := range uint32(window) {
+			if (i+1)%lossInterval != 0 {
+				r.remove(sequenceID + i)
+			}
+		}
+
+		for r.len() > 0 {
+			now = now.Add(rto)
+			for {
+				pk, _, dropped := r.shift(now, rto)
+				if pk == nil {
+					break
+				}
+
+				if dropped {
+					pk.release()
+				}
+			}
+		}
+		sequenceID += window
+	}
+}
+
+func BenchmarkRetransmissionQueue(b *testing.B) {
+	b.Run("NoLoss", func(b *testing.B) { benchmarkRetransmissionQueue(b, math.MaxUint32) })
+	b.Run("Loss1%", func(b *testing.B) { benchmarkRetransmissionQueue(b, 100) })
+}
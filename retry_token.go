@@ -0,0 +1,54 @@
+package spectral
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"net"
+	"time"
+)
+
+const (
+	retryTokenLifetime = time.Second * 10
+	retryTokenSize     = 8 + sha256.Size
+)
+
+type retryTokens struct {
+	key []byte
+}
+
+func newRetryTokens() *retryTokens {
+	key := make([]byte, 32)
+	_, _ = rand.Read(key)
+	return &retryTokens{key: key}
+}
+
+func (r *retryTokens) generate(now time.Time, addr net.Addr) []byte {
+	token := binary.LittleEndian.AppendUint64(make([]byte, 0, retryTokenSize), uint64(now.Unix()))
+	return r.sign(token, addr)
+}
+
+func (r *retryTokens) validate(now time.Time, addr net.Addr, token []byte) bool {
+	if len(token) != retryTokenSize {
+		return false
+	}
+
+	issued := time.Unix(int64(binary.LittleEndian.Uint64(token[0:8])), 0)
+	if now.Sub(issued) > retryTokenLifetime || issued.After(now) {
+		return false
+	}
+	return hmac.Equal(token, r.sign(token[0:8:8], addr))
+}
+
+func (r *retryTokens) sign(token []byte, addr net.Addr) []byte {
+	mac := hmac.New(sha256.New, r.key)
+	mac.Write(token[0:8])
+	if addr, ok := addr.(*net.UDPAddr); ok {
+		mac.Write(addr.IP.To16())
+		mac.Write(binary.LittleEndian.AppendUint16(nil, uint16(addr.Port)))
+	} else {
+		mac.Write([]byte(addr.String()))
+	}
+	return mac.Sum(token)
+}
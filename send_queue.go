@@ -1,29 +1,149 @@
 package spectral
 
 import (
+	"slices"
 	"sync"
+	"sync/atomic"
 
+	"github.com/cooldogedev/spectral/internal/frame"
 	"github.com/cooldogedev/spectral/internal/protocol"
 )
 
+type streamCredit struct {
+	queue *streamQueue
+	n     int
+}
+
+type streamQueue struct {
+	queue       []*packet
+	head        int
+	deficit     int
+	urgency     uint8
+	incremental bool
+	active      bool
+	buffered    atomic.Int64
+	writable    chan struct{}
+}
+
+func newStreamQueue() *streamQueue {
+	return &streamQueue{urgency: DefaultStreamUrgency, incremental: true, writable: make(chan struct{}, 1)}
+}
+
+func (q *streamQueue) reserve(n, least, limit int) int {
+	free := limit - int(q.buffered.Load())
+	if free < min(least, limit) {
+		return 0
+	}
+	n = min(n, free)
+	q.buffered.Add(int64(n))
+	return n
+}
+
+func (q *streamQueue) credit(n int) {
+	q.buffered.Add(-int64(n))
+	select {
+	case q.writable <- struct{}{}:
+	default:
+	}
+}
+
+func (q *streamQueue) len() int {
+	return len(q.queue) - q.head
+}
+
+func (q *streamQueue) push(entry *packet) {
+	q.queue = append(q.queue, entry)
+}
+
+func (q *streamQueue) pop() {
+	q.queue[q.head] = nil
+	q.head++
+	if q.head == len(q.queue) {
+		q.queue = q.queue[:0]
+		q.head = 0
+	} else if q.head > len(q.queue)/2 {
+		n := copy(q.queue, q.queue[q.head:])
+		clear(q.queue[n:])
+		q.queue = q.queue[:n]
+		q.head = 0
+	}
+}
+
+func (q *streamQueue) clear() {
+	for _, entry := range q.queue[q.head:] {
+		entry.release()
+	}
+	q.queue = nil
+	q.head = 0
+	q.deficit = 0
+	q.active = false
+}
+
+type priorityLevel struct {
+	active []*streamQueue
+	cursor int
+}
+
+func (l *priorityLevel) add(q *streamQueue, quantum int) {
+	l.active = append(l.active, q)
+	if len(l.active) == 1 {
+		l.cursor = 0
+		q.deficit += quantum
+	}
+}
+
+func (l *priorityLevel) remove(i int, quantum int) {
+	l.active = slices.Delete(l.active, i, i+1)
+	if i < l.cursor {
+		l.cursor--
+	} else if i == l.cursor {
+		l.advance(l.cursor, quantum)
+	}
+}
+
+func (l *priorityLevel) advance(cursor int, quantum int) {
+	if len(l.active) == 0 {
+		l.cursor = 0
+		return
+	}
+	l.cursor = cursor % len(l.active)
+	l.active[l.cursor].deficit += quantum
+}
+
 type sendQueue struct {
-	queue          [][]byte
-	pk             []byte
+	levels         [MaxStreamUrgency + 1]priorityLevel
+	pending        int
+	pk             *packet
 	maxSegmentSize uint64
+	pool           *packetPool
+	closing        chan struct{}
+	once           sync.Once
 	mu             sync.RWMutex
 }
 
-func newSendQueue() *sendQueue {
-	return &sendQueue{
-		pk:             make([]byte, 0, protocol.MaxPacketSize),
-		maxSegmentSize: protocol.MinPacketSize,
+func newSendQueue(pool *packetPool) *sendQueue {
+	return &sendQueue{maxSegmentSize: protocol.MinPacketSize, pool: pool, closing: make(chan struct{})}
+}
+
+func (s *sendQueue) stopWrites() {
+	s.once.Do(func() {
+		close(s.closing)
+	})
+}
+
+func (s *sendQueue) stopped() bool {
+	select {
+	case <-s.closing:
+		return true
+	default:
+		return false
 	}
 }
 
 func (s *sendQueue) available() bool {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	return len(s.queue) > 0 || len(s.pk) > 0
+	return s.pending > 0 || (s.pk != nil && len(s.pk.b) > protocol.PacketHeaderSize)
 }
 
 func (s *sendQueue) mss() uint64 {
@@ -38,46 +158,118 @@ func (s *sendQueue) setMSS(mss uint64) {
 	s.mu.Unlock()
 }
 
-func (s *sendQueue) add(p []byte) {
+func (s *sendQueue) add(q *streamQueue, fr frame.Frame) {
+	entry := s.pool.get()
+	entry.b = frame.Append(entry.b, fr)
+	if fr, ok := fr.(*frame.StreamData); ok {
+		entry.streams = append(entry.streams, streamCredit{queue: q, n: len(fr.Payload)})
+	}
 	s.mu.Lock()
-	s.queue = append(s.queue, p)
+	q.push(entry)
+	if !q.active {
+		q.active = true
+		s.pending++
+		s.levels[q.urgency].add(q, int(s.maxSegmentSize))
+	}
 	s.mu.Unlock()
 }
 
-func (s *sendQueue) pack(window uint64) []byte {
+func (s *sendQueue) setPriority(q *streamQueue, urgency uint8, incremental bool) {
+	urgency = min(urgency, MaxStreamUrgency)
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	if len(s.queue) == 0 && len(s.pk) == 0 {
-		return nil
+	if q.active && q.urgency != urgency {
+		level := &s.levels[q.urgency]
+		level.remove(slices.Index(level.active, q), int(s.maxSegmentSize))
+		q.deficit = 0
+		s.levels[urgency].add(q, int(s.maxSegmentSize))
 	}
+	q.urgency, q.incremental = urgency, incremental
+}
+
+func (s *sendQueue) priority(q *streamQueue) (urgency uint8, incremental bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return q.urgency, q.incremental
+}
 
-	size := int(min(window, s.maxSegmentSize))
-	for len(s.queue) > 0 {
-		entry := s.queue[0]
-		if len(s.pk)+len(entry) > size {
+func (s *sendQueue) pack(window uint64) *packet {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pk == nil {
+		if s.pending == 0 {
+			return nil
+		}
+		s.pk = s.pool.get()
+		s.pk.b = s.pk.b[:protocol.PacketHeaderSize]
+	}
+
+	size, quantum := int(min(window, s.maxSegmentSize)), int(s.maxSegmentSize)
+	for s.pending > 0 {
+		level := s.next()
+		q := level.active[level.cursor]
+		entry := q.queue[q.head]
+		if len(s.pk.b)-protocol.PacketHeaderSize+len(entry.b) > size {
 			break
 		}
-		s.queue[0] = nil
-		s.queue = s.queue[1:]
-		s.pk = append(s.pk, entry...)
+
+		if q.incremental {
+			if len(entry.b) > q.deficit {
+				level.advance(level.cursor+1, quantum)
+				continue
+			}
+			q.deficit -= len(entry.b)
+		}
+
+		s.pk.b = append(s.pk.b, entry.b...)
+		for _, c := range entry.streams {
+			if last := len(s.pk.streams) - 1; last >= 0 && s.pk.streams[last].queue == c.queue {
+				s.pk.streams[last].n += c.n
+			} else {
+				s.pk.streams = append(s.pk.streams, c)
+			}
+		}
+		clear(entry.streams)
+		entry.streams = entry.streams[:0]
+		entry.release()
+		q.pop()
+		if q.len() == 0 {
+			q.deficit = 0
+			q.active = false
+			s.pending--
+			level.remove(level.cursor, quantum)
+		}
 	}
 	return s.pk
 }
 
+func (s *sendQueue) next() *priorityLevel {
+	for i := range s.levels {
+		if len(s.levels[i].active) > 0 {
+			return &s.levels[i]
+		}
+	}
+	return nil
+}
+
 func (s *sendQueue) flush() {
 	s.mu.Lock()
-	s.pk = s.pk[:0]
+	s.pk = nil
 	s.mu.Unlock()
 }
 
 func (s *sendQueue) clear() {
 	s.mu.Lock()
-	for i := range s.queue {
-		s.queue[i] = nil
+	for i := range s.levels {
+		for _, q := range s.levels[i].active {
+			q.clear()
+		}
+		s.levels[i] = priorityLevel{}
+	}
+	s.pending = 0
+	if s.pk != nil {
+		s.pk.release()
+		s.pk = nil
 	}
-	s.queue = s.queue[:0]
-	s.queue = nil
-	s.pk = s.pk[:0]
-	s.pk = nil
 	s.mu.Unlock()
 }
@@ -0,0 +1,234 @@
+package spectral
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/cooldogedev/spectral/internal/frame"
+	"github.com/cooldogedev/spectral/internal/protocol"
+)
+
+func addStreamData(s *sendQueue, q *streamQueue, streamID protocol.StreamID, sequenceID uint32, size int) {
+	s.add(q, &frame.StreamData{StreamID: streamID, SequenceID: sequenceID, Payload: make([]byte, size)})
+}
+
+func packStreams(t *testing.T, s *sendQueue) (streams []protocol.StreamID) {
+	t.Helper()
+	pk := s.pack(s.mss())
+	if pk == nil {
+		return nil
+	}
+	s.flush()
+	defer pk.release()
+
+	var reader frame.Reader
+	for p := pk.b[protocol.PacketHeaderSize:]; len(p) > 0; {
+		fr, n, err := reader.Next(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		switch fr := fr.(type) {
+		case *frame.StreamData:
+			streams = append(streams, fr.StreamID)
+		case *frame.StreamClose:
+			streams = append(streams, -fr.StreamID)
+		}
+		p = p[n:]
+	}
+	return
+}
+
+func TestSendQueueRoundRobin(t *testing.T) {
+	s := newSendQueue(newPacketPool(protocol.MaxPacketSize))
+	bulk, chat := newStreamQueue(), newStreamQueue()
+	for i := range 100 {
+		addStreamData(s, bulk, 1, uint32(i), 1000)
+	}
+	addStreamData(s, chat, 2, 0, 10)
+
+	if streams := packStreams(t, s); len(streams) != 1 || streams[0] != 1 {
+		t.Fatalf("expected the first packet to carry stream 1, got %v", streams)
+	}
+
+	if streams := packStreams(t, s); len(streams) == 0 || streams[0] != 2 {
+		t.Fatalf("expected stream 2 to be scheduled before the rest of stream 1, got %v", streams)
+	}
+
+	packets := 0
+	for s.available() {
+		packStreams(t, s)
+		packets++
+	}
+
+	if packets != 98 {
+		t.Fatalf("expected 98 packets of stream 1 to remain, got %v", packets)
+	}
+}
+
+func TestSendQueueDeficit(t *testing.T) {
+	s := newSendQueue(newPacketPool(protocol.MaxPacketSize))
+	small, large := newStreamQueue(), newStreamQueue()
+	for i := range 200 {
+		addStreamData(s, small, 1, uint32(i), 80)
+	}
+
+	for i := range 20 {
+		addStreamData(s, large, 2, uint32(i), 1000)
+	}
+
+	counts := map[protocol.StreamID]int{}
+	for range 10 {
+		for _, streamID := range packStreams(t, s) {
+			counts[streamID]++
+		}
+	}
+
+	smallBytes, largeBytes := counts[1]*100, counts[2]*1020
+	if smallBytes == 0 || largeBytes == 0 || smallBytes > largeBytes*2 || largeBytes > smallBytes*2 {
+		t.Fatalf("expected streams to share bytes fairly, got %v and %v", smallBytes, largeBytes)
+	}
+}
+
+func TestSendQueueCoalescesStreams(t *testing.T) {
+	s := newSendQueue(newPacketPool(protocol.MaxPacketSize))
+	queues := []*streamQueue{newStreamQueue(), newStreamQueue(), newStreamQueue()}
+	for i, q := range queues {
+		addStreamData(s, q, protocol.StreamID(i+1), 0, 100)
+	}
+
+	if streams := packStreams(t, s); len(streams) != 3 {
+		t.Fatalf("expected three streams in one packet, got %v", streams)
+	}
+}
+
+func TestStreamCloseFollowsData(t *testing.T) {
+	s := newSendQueue(newPacketPool(protocol.MaxPacketSize))
+	bulk, other := newStreamQueue(), newStreamQueue()
+	for i := range 3 {
+		addStreamData(s, bulk, 1, uint32(i), 1000)
+	}
+	s.add(bulk, &frame.StreamClose{StreamID: 1})
+	addStreamData(s, other, 2, 0, 1000)
+
+	var order []protocol.StreamID
+	for s.available() {
+		order = append(order, packStreams(t, s)...)
+	}
+
+	data := 0
+	for _, streamID := range order {
+		switch streamID {
+		case 1:
+			data++
+		case -1:
+			if data != 3 {
+				t.Fatalf("stream close overtook data, got %v", order)
+			}
+			return
+		}
+	}
+	t.Fatalf("stream close was never sent, got %v", order)
+}
+
+func TestSendQueueClear(t *testing.T) {
+	s := newSendQueue(newPacketPool(protocol.MaxPacketSize))
+	q := newStreamQueue()
+	addStreamData(s, q, 1, 0, 100)
+	s.clear()
+	if s.available() || q.len() != 0 || q.active {
+		t.Fatal("expected clear to drop every stream queue")
+	}
+
+	addStreamData(s, q, 1, 1, 100)
+	if streams := packStreams(t, s); len(streams) != 1 {
+		t.Fatalf("expected the stream to be rescheduled after clear, got %v", streams)
+	}
+}
+
+func TestSendQueueUrgency(t *testing.T) {
+	s := newSendQueue(newPacketPool(protocol.MaxPacketSize))
+	telemetry, world, movement := newStreamQueue(), newStreamQueue(), newStreamQueue()
+	s.setPriority(telemetry, MaxStreamUrgency, true)
+	s.setPriority(movement, 0, true)
+	for i := range 5 {
+		addStreamData(s, telemetry, 1, uint32(i), 1000)
+		addStreamData(s, world, 2, uint32(i), 1000)
+	}
+	addStreamData(s, movement, 3, 0, 1000)
+
+	var order []protocol.StreamID
+	for s.available() {
+		order = append(order, packStreams(t, s)...)
+	}
+
+	expected := []protocol.StreamID{3, 2, 2, 2, 2, 2, 1, 1, 1, 1, 1}
+	if !slices.Equal(order, expected) {
+		t.Fatalf("expected %v, got %v", expected, order)
+	}
+}
+
+func TestSendQueueNonIncremental(t *testing.T) {
+	s := newSendQueue(newPacketPool(protocol.MaxPacketSize))
+	first, second := newStreamQueue(), newStreamQueue()
+	s.setPriority(first, DefaultStreamUrgency, false)
+	s.setPriority(second, DefaultStreamUrgency, false)
+	for i := range 3 {
+		addStreamData(s, first, 1, uint32(i), 1000)
+		addStreamData(s, second, 2, uint32(i), 1000)
+	}
+
+	var order []protocol.StreamID
+	for s.available() {
+		order = append(order, packStreams(t, s)...)
+	}
+
+	if expected := []protocol.StreamID{1, 1, 1, 2, 2, 2}; !slices.Equal(order, expected) {
+		t.Fatalf("expected %v, got %v", expected, order)
+	}
+}
+
+func TestSendQueueSetPriorityWhileQueued(t *testing.T) {
+	s := newSendQueue(newPacketPool(protocol.MaxPacketSize))
+	bulk, late := newStreamQueue(), newStreamQueue()
+	for i := range 3 {
+		addStreamData(s, bulk, 1, uint32(i), 1000)
+	}
+	addStreamData(s, late, 2, 0, 1000)
+	s.setPriority(late, 0, false)
+	if urgency, incremental := s.priority(late); urgency != 0 || incremental {
+		t.Fatalf("unexpected priority %v, %v", urgency, incremental)
+	}
+
+	if streams := packStreams(t, s); !slices.Equal(streams, []protocol.StreamID{2}) {
+		t.Fatalf("expected the reprioritised stream first, got %v", streams)
+	}
+
+	s.setPriority(bulk, 200, true)
+	if urgency, _ := s.priority(bulk); urgency != MaxStreamUrgency {
+		t.Fatalf("expected urgency to be capped at %v, got %v", MaxStreamUrgency, urgency)
+	}
+
+	for range 3 {
+		if streams := packStreams(t, s); !slices.Equal(streams, []protocol.StreamID{1}) {
+			t.Fatalf("expected stream 1, got %v", streams)
+		}
+	}
+
+	if s.available() {
+		t.Fatal("expected the queue to be drained")
+	}
+}
+
+func TestPacketPoolSizeClasses(t *testing.T) {
+	small, large := newPacketPool(protocol.MaxPacketSize), newPacketPool(8952)
+	if small == large || newPacketPool(8952) != large {
+		t.Fatal("expected one pool per packet size")
+	}
+
+	pk := large.get()
+	if cap(pk.b) != protocol.PacketHeaderSize+8952 {
+		t.Fatalf("expected a %v byte buffer, got %v", protocol.PacketHeaderSize+8952, cap(pk.b))
+	}
+	pk.release()
+}
@@ -11,13 +11,15 @@ import (
 
 type ServerConnection struct {
 	*connection
-	streamRequests chan *frame.StreamRequest
+	streamRequests chan protocol.StreamID
+	metrics        *listenerMetrics
 }
 
-func newServerConnection(conn *udpConn, peerAddr *net.UDPAddr, connectionID protocol.ConnectionID, ctx context.Context) *ServerConnection {
+func newServerConnection(conn *udpConn, peerAddr net.Addr, connectionID, peerID protocol.ConnectionID, ctx context.Context, config *Config, metrics *listenerMetrics) *ServerConnection {
 	c := &ServerConnection{
-		connection:     newConnection(conn, peerAddr, connectionID, ctx, log.PerspectiveServer),
-		streamRequests: make(chan *frame.StreamRequest, 100),
+		connection:     newConnection(conn, peerAddr, connectionID, peerID, ctx, log.PerspectiveServer, config),
+		streamRequests: make(chan protocol.StreamID, config.StreamAcceptQueueLength),
+		metrics:        metrics,
 	}
 	c.connection.handler = c.handle
 	c.logger.SetConnectionID(connectionID)
@@ -28,17 +30,19 @@ func (c *ServerConnection) AcceptStream(ctx context.Context) (*Stream, error) {
 	select {
 	case <-ctx.Done():
 		return nil, context.Cause(ctx)
-	case request := <-c.streamRequests:
-		c.logger.Log("stream_accept", "streamID", request.StreamID)
-		stream, err := c.createStream(request.StreamID)
+	case <-c.ctx.Done():
+		return nil, context.Cause(c.ctx)
+	case streamID := <-c.streamRequests:
+		c.logger.Log("stream_accept", "streamID", streamID)
+		stream, err := c.createStream(streamID)
 		if err != nil {
 			return nil, err
 		}
 
-		if err := c.writeControl(&frame.StreamResponse{StreamID: request.StreamID, Response: frame.StreamResponseSuccess}, true); err != nil {
+		if err := c.writeControl(&frame.StreamResponse{StreamID: streamID, Response: frame.StreamResponseSuccess}, true); err != nil {
 			return nil, err
 		}
-		c.logger.Log("stream_accept_success", "streamID", request.StreamID)
+		c.logger.Log("stream_accept_success", "streamID", streamID)
 		return stream, nil
 	}
 }
@@ -46,11 +50,37 @@ func (c *ServerConnection) AcceptStream(ctx context.Context) (*Stream, error) {
 func (c *ServerConnection) handle(fr frame.Frame) (err error) {
 	switch fr := fr.(type) {
 	case *frame.ConnectionRequest:
-		if err := c.writeControl(&frame.ConnectionResponse{ConnectionID: protocol.ConnectionID(c.connectionID.Load()), Response: frame.ConnectionResponseSuccess}, true); err != nil {
+		if !c.negotiate(c.clock.Now(), fr.Parameters) {
+			return
+		}
+
+		response := &frame.ConnectionResponse{
+			ConnectionID: protocol.ConnectionID(c.connectionID.Load()),
+			Response:     frame.ConnectionResponseSuccess,
+			Version:      protocol.Version,
+			Parameters:   c.transportParameters(),
+		}
+		if err := c.writeControl(response, true); err != nil {
 			return err
 		}
 	case *frame.StreamRequest:
-		c.streamRequests <- fr
+		if c.goingAway() || c.sendQueue.stopped() {
+			c.logger.Log("stream_refused_go_away", "streamID", fr.StreamID)
+			return c.writeControl(&frame.StreamResponse{StreamID: fr.StreamID, Response: frame.StreamResponseFailed}, true)
+		}
+
+		if maxStreams := c.config.MaxStreams; maxStreams > 0 && c.streams.len()+len(c.streamRequests) >= maxStreams {
+			c.logger.Log("stream_limit_reached", "streamID", fr.StreamID)
+			return c.writeControl(&frame.StreamResponse{StreamID: fr.StreamID, Response: frame.StreamResponseFailed}, true)
+		}
+
+		select {
+		case c.streamRequests <- fr.StreamID:
+		default:
+			c.metrics.refusedStreams.Add(1)
+			c.logger.Log("stream_accept_queue_full", "streamID", fr.StreamID)
+			return c.writeControl(&frame.StreamResponse{StreamID: fr.StreamID, Response: frame.StreamResponseFailed}, true)
+		}
 	}
 	return
 }
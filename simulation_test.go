@@ -0,0 +1,143 @@
+//go:build go1.25
+
+package spectral
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/cooldogedev/spectral/spectraltest"
+)
+
+func newSimulatedPair(t *testing.T, link spectraltest.LinkConfig) *pipePair {
+	t.Helper()
+	pair := newPipePair(t, link, nil, nil)
+	t.Cleanup(func() {
+		_ = pair.client.CloseWithError(0, "")
+		_ = pair.listener.Close()
+		_ = pair.clientPacket.Close()
+		<-pair.client.(*ClientConnection).done
+		<-pair.server.(*ServerConnection).done
+	})
+	return pair
+}
+
+func simulate(t *testing.T, link spectraltest.LinkConfig, size int) (elapsed time.Duration, stats spectraltest.LinkStats) {
+	t.Helper()
+	synctest.Test(t, func(t *testing.T) {
+		pair := newSimulatedPair(t, link)
+		server, client := pair.streams(t)
+		payload := make([]byte, size)
+		for i := range payload {
+			payload[i] = byte(i)
+		}
+
+		start := time.Now()
+		if _, err := client.Write(payload); err != nil {
+			t.Fatal(err)
+		}
+
+		received := make([]byte, size)
+		if _, err := io.ReadFull(server, received); err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(payload, received) {
+			t.Fatal("received payload does not match sent payload")
+		}
+		elapsed, stats = time.Since(start), pair.clientPacket.Stats()
+	})
+	return
+}
+
+func TestConnectionSimulatedTransfer(t *testing.T) {
+	start := time.Now()
+	elapsed, stats := simulate(t, spectraltest.LinkConfig{
+		Latency:   time.Millisecond * 50,
+		Jitter:    time.Millisecond * 5,
+		Bandwidth: 32 * 1024,
+		Loss:      0.02,
+		Seed:      7,
+	}, 2*1024*1024)
+	if elapsed < time.Minute {
+		t.Fatalf("expected transfer to take at least a minute of virtual time, took %v", elapsed)
+	}
+
+	if stats.Lost == 0 {
+		t.Fatal("expected the link to drop packets")
+	}
+	t.Logf("transferred in %v virtual time, %v real time: %+v", elapsed, time.Since(start), stats)
+}
+
+func TestConnectionSimulationReproducible(t *testing.T) {
+	link := spectraltest.LinkConfig{
+		Latency:   time.Millisecond * 30,
+		Jitter:    time.Millisecond * 10,
+		Bandwidth: 256 * 1024,
+		Loss:      0.03,
+		Reorder:   0.02,
+		Seed:      42,
+	}
+	elapsed, stats := simulate(t, link, 512*1024)
+	if stats.Lost == 0 || stats.Reordered == 0 {
+		t.Fatalf("expected the link to drop and reorder packets: %+v", stats)
+	}
+
+	for range 2 {
+		if e, s := simulate(t, link, 512*1024); e != elapsed || s != stats {
+			t.Fatalf("simulation diverged: %v %+v, expected %v %+v", e, s, elapsed, stats)
+		}
+	}
+}
+
+func TestConnectionStreamFairness(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		pair := newSimulatedPair(t, spectraltest.LinkConfig{Latency: time.Millisecond * 20, Bandwidth: 256 * 1024})
+		bulkServer, bulkClient := pair.streams(t)
+		chatServer, chatClient := pair.streams(t)
+
+		bulk := make(chan time.Time, 1)
+		go func() {
+			_, _ = io.CopyN(io.Discard, bulkServer, 2*1024*1024)
+			bulk <- time.Now()
+		}()
+
+		start := time.Now()
+		payload := make([]byte, 2*1024*1024)
+		n, err := bulkClient.TryWrite(payload)
+		if err != nil || n == 0 {
+			t.Fatalf("expected the bulk stream to buffer data, got %v, %v", n, err)
+		}
+
+		written := make(chan error, 1)
+		go func() {
+			_, err := bulkClient.Write(payload[n:])
+			written <- err
+		}()
+
+		if _, err := chatClient.Write([]byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := io.ReadFull(chatServer, make([]byte, 5)); err != nil {
+			t.Fatal(err)
+		}
+		chat := time.Since(start)
+
+		finished := (<-bulk).Sub(start)
+		if err := <-written; err != nil {
+			t.Fatal(err)
+		}
+
+		if chat >= finished {
+			t.Fatalf("chat message took %v, blocked behind a bulk transfer that took %v", chat, finished)
+		}
+
+		if chat > time.Second {
+			t.Fatalf("expected chat message within a second of virtual time, took %v", chat)
+		}
+	})
+}
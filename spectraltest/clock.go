@@ -0,0 +1,140 @@
+package spectraltest
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+
+	"github.com/cooldogedev/spectral/internal/clock"
+)
+
+var epoch = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+type Clock struct {
+	now     time.Time
+	timers  timerHeap
+	counter uint64
+	mu      sync.Mutex
+}
+
+func NewClock() *Clock {
+	return &Clock{now: epoch}
+}
+
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *Clock) Elapsed() time.Duration {
+	return c.Now().Sub(epoch)
+}
+
+func (c *Clock) NewTimer(d time.Duration) clock.Timer {
+	t := &virtualTimer{clock: c, ch: make(chan time.Time, 1), index: -1}
+	t.Reset(d)
+	return t
+}
+
+func (c *Clock) Advance(d time.Duration) {
+	c.advanceTo(c.Now().Add(d))
+}
+
+func (c *Clock) advanceTo(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.timers) > 0 && !c.timers[0].at.After(t) {
+		timer := heap.Pop(&c.timers).(*virtualTimer)
+		c.now = later(c.now, timer.at)
+		timer.fire()
+	}
+	c.now = later(c.now, t)
+}
+
+type virtualTimer struct {
+	clock *Clock
+	ch    chan time.Time
+	at    time.Time
+	seq   uint64
+	index int
+}
+
+func (t *virtualTimer) C() <-chan time.Time {
+	return t.ch
+}
+
+func (t *virtualTimer) Reset(d time.Duration) bool {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	active := t.stop()
+	t.at = c.now.Add(d)
+	if d <= 0 {
+		t.fire()
+		return active
+	}
+	c.counter++
+	t.seq = c.counter
+	heap.Push(&c.timers, t)
+	return active
+}
+
+func (t *virtualTimer) Stop() bool {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return t.stop()
+}
+
+func (t *virtualTimer) stop() bool {
+	select {
+	case <-t.ch:
+	default:
+	}
+
+	if t.index < 0 {
+		return false
+	}
+	heap.Remove(&t.clock.timers, t.index)
+	return true
+}
+
+func (t *virtualTimer) fire() {
+	select {
+	case t.ch <- t.at:
+	default:
+	}
+}
+
+type timerHeap []*virtualTimer
+
+func (h timerHeap) Len() int { return len(h) }
+
+func (h timerHeap) Less(i, j int) bool {
+	if h[i].at.Equal(h[j].at) {
+		return h[i].seq < h[j].seq
+	}
+	return h[i].at.Before(h[j].at)
+}
+
+func (h timerHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *timerHeap) Push(x any) {
+	t := x.(*virtualTimer)
+	t.index = len(*h)
+	*h = append(*h, t)
+}
+
+func (h *timerHeap) Pop() any {
+	old := *h
+	t := old[len(old)-1]
+	old[len(old)-1] = nil
+	t.index = -1
+	*h = old[:len(old)-1]
+	return t
+}
@@ -0,0 +1,71 @@
+package spectraltest
+
+import (
+	"testing"
+	"time"
+)
+
+func fired(timer interface{ C() <-chan time.Time }) bool {
+	select {
+	case <-timer.C():
+		return true
+	default:
+		return false
+	}
+}
+
+func TestClockAdvance(t *testing.T) {
+	c := NewClock()
+	first := c.NewTimer(time.Second)
+	second := c.NewTimer(time.Second * 2)
+	c.Advance(time.Millisecond * 1500)
+	if !fired(first) || fired(second) {
+		t.Fatal("expected only the first timer to fire")
+	}
+
+	if c.Elapsed() != time.Millisecond*1500 {
+		t.Fatalf("expected 1.5s elapsed, got %v", c.Elapsed())
+	}
+
+	c.Advance(time.Second)
+	if !fired(second) {
+		t.Fatal("expected the second timer to fire")
+	}
+}
+
+func TestClockStopReset(t *testing.T) {
+	c := NewClock()
+	timer := c.NewTimer(time.Second)
+	if !timer.Stop() {
+		t.Fatal("expected stop to report an active timer")
+	}
+
+	c.Advance(time.Second * 2)
+	if fired(timer) {
+		t.Fatal("stopped timer fired")
+	}
+
+	if timer.Reset(time.Second) {
+		t.Fatal("expected reset to report an inactive timer")
+	}
+
+	c.Advance(time.Second)
+	if !fired(timer) {
+		t.Fatal("reset timer did not fire")
+	}
+}
+
+func TestPipeVirtualLatency(t *testing.T) {
+	c := NewClock()
+	a, b := Pipe(LinkConfig{Latency: time.Minute, Clock: c})
+	defer a.Close()
+	_, _ = a.WriteTo([]byte("ping"), b.LocalAddr())
+	c.Advance(time.Minute)
+	if _, err := read(t, b, time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	if c.Elapsed() < time.Minute {
+		t.Fatalf("packet delivered after %v of virtual time", c.Elapsed())
+	}
+}
@@ -0,0 +1,175 @@
+package spectraltest
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cooldogedev/spectral/internal/clock"
+	"github.com/cooldogedev/spectral/internal/deadline"
+)
+
+var pipeID atomic.Uint64
+
+type Addr string
+
+func (a Addr) Network() string {
+	return "spectraltest"
+}
+
+func (a Addr) String() string {
+	return string(a)
+}
+
+type Conn struct {
+	local         Addr
+	remote        Addr
+	link          *link
+	peer          *Conn
+	incoming      chan []byte
+	clock         clock.Clock
+	readDeadline  *deadline.Deadline
+	writeDeadline *deadline.Deadline
+	closed        chan struct{}
+	once          sync.Once
+}
+
+func Pipe(config LinkConfig) (*Conn, *Conn) {
+	reverse := config
+	reverse.Seed = config.Seed + 1
+	return AsymmetricPipe(config, reverse)
+}
+
+func AsymmetricPipe(aToB, bToA LinkConfig) (*Conn, *Conn) {
+	id := pipeID.Add(1)
+	a := newConn(Addr(fmt.Sprintf("pipe-%d-a", id)), Addr(fmt.Sprintf("pipe-%d-b", id)), bToA)
+	b := newConn(a.remote, a.local, aToB)
+	a.peer, b.peer = b, a
+	a.link = newLink(aToB, b)
+	b.link = newLink(bToA, a)
+	return a, b
+}
+
+func newConn(local, remote Addr, incoming LinkConfig) *Conn {
+	queueLength, clk := incoming.QueueLength, incoming.Clock
+	if queueLength <= 0 {
+		queueLength = defaultQueueLength
+	}
+
+	if clk == nil {
+		clk = clock.Wall
+	}
+	return &Conn{
+		local:         local,
+		remote:        remote,
+		incoming:      make(chan []byte, queueLength),
+		clock:         clk,
+		readDeadline:  deadline.New(clk),
+		writeDeadline: deadline.New(clk),
+		closed:        make(chan struct{}),
+	}
+}
+
+func (c *Conn) ReadFrom(p []byte) (n int, addr net.Addr, err error) {
+	for {
+		remaining, changed := c.readDeadline.Remaining()
+		var (
+			timer   clock.Timer
+			timeout <-chan time.Time
+		)
+		if remaining != deadline.Inf {
+			timer = c.clock.NewTimer(remaining)
+			timeout = timer.C()
+		}
+
+		select {
+		case <-c.closed:
+			return 0, nil, net.ErrClosed
+		case b := <-c.incoming:
+			stopTimer(timer)
+			return copy(p, b), c.remote, nil
+		case <-timeout:
+			return 0, nil, os.ErrDeadlineExceeded
+		case <-changed:
+			stopTimer(timer)
+		}
+	}
+}
+
+func (c *Conn) WriteTo(p []byte, addr net.Addr) (n int, err error) {
+	select {
+	case <-c.closed:
+		return 0, net.ErrClosed
+	default:
+	}
+
+	if c.writeDeadline.Exceeded() {
+		return 0, os.ErrDeadlineExceeded
+	}
+
+	if addr.String() == c.remote.String() {
+		c.link.send(p)
+	}
+	return len(p), nil
+}
+
+func (c *Conn) Stats() LinkStats {
+	return c.link.snapshot()
+}
+
+func (c *Conn) DontFragment() bool {
+	return true
+}
+
+func (c *Conn) Close() error {
+	c.once.Do(func() {
+		close(c.closed)
+		c.link.close()
+		c.peer.link.close()
+	})
+	return nil
+}
+
+func (c *Conn) LocalAddr() net.Addr {
+	return c.local
+}
+
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+func (c *Conn) SetDeadline(t time.Time) error {
+	c.readDeadline.Set(t)
+	c.writeDeadline.Set(t)
+	return nil
+}
+
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.readDeadline.Set(t)
+	return nil
+}
+
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	c.writeDeadline.Set(t)
+	return nil
+}
+
+func (c *Conn) deliver(b []byte) bool {
+	select {
+	case <-c.closed:
+		return false
+	case c.incoming <- b:
+		return true
+	default:
+		return false
+	}
+}
+
+func stopTimer(timer clock.Timer) {
+	if timer != nil {
+		timer.Stop()
+	}
+}
@@ -0,0 +1,209 @@
+package spectraltest
+
+import (
+	"container/heap"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/cooldogedev/spectral/internal/clock"
+)
+
+const defaultQueueLength = 1024
+
+type LinkConfig struct {
+	Latency     time.Duration
+	Jitter      time.Duration
+	Bandwidth   int
+	Loss        float64
+	Reorder     float64
+	Duplicate   float64
+	MTU         int
+	QueueLength int
+	Seed        uint64
+	Clock       clock.Clock
+}
+
+type LinkStats struct {
+	Sent       uint64
+	Delivered  uint64
+	Lost       uint64
+	Duplicated uint64
+	Reordered  uint64
+	Oversized  uint64
+	Dropped    uint64
+}
+
+type link struct {
+	config  LinkConfig
+	dst     *Conn
+	rand    *rand.Rand
+	queue   packetHeap
+	busy    time.Time
+	last    time.Time
+	counter uint64
+	stats   LinkStats
+	wake    chan struct{}
+	closed  chan struct{}
+	mu      sync.Mutex
+	once    sync.Once
+}
+
+func newLink(config LinkConfig, dst *Conn) *link {
+	if config.QueueLength <= 0 {
+		config.QueueLength = defaultQueueLength
+	}
+
+	if config.Clock == nil {
+		config.Clock = clock.Wall
+	}
+	l := &link{
+		config: config,
+		dst:    dst,
+		rand:   rand.New(rand.NewPCG(config.Seed, config.Seed^0x9e3779b97f4a7c15)),
+		wake:   make(chan struct{}, 1),
+		closed: make(chan struct{}),
+	}
+	go l.run()
+	return l
+}
+
+func (l *link) send(p []byte) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.stats.Sent++
+	if l.config.MTU > 0 && len(p) > l.config.MTU {
+		l.stats.Oversized++
+		return
+	}
+
+	if l.chance(l.config.Loss) {
+		l.stats.Lost++
+		return
+	}
+
+	copies := 1
+	if l.chance(l.config.Duplicate) {
+		l.stats.Duplicated++
+		copies++
+	}
+
+	now := l.config.Clock.Now()
+	for range copies {
+		if len(l.queue) >= l.config.QueueLength {
+			l.stats.Dropped++
+			return
+		}
+		l.counter++
+		heap.Push(&l.queue, &packet{b: append([]byte(nil), p...), at: l.deliveryTime(now, len(p)), index: l.counter})
+	}
+
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (l *link) deliveryTime(now time.Time, size int) time.Time {
+	start := now
+	if l.config.Bandwidth > 0 {
+		start = later(now, l.busy).Add(time.Duration(int64(size) * int64(time.Second) / int64(l.config.Bandwidth)))
+		l.busy = start
+	}
+
+	at := start.Add(l.config.Latency)
+	if l.config.Jitter > 0 {
+		at = at.Add(time.Duration(l.rand.Int64N(int64(2*l.config.Jitter))) - l.config.Jitter)
+	}
+
+	if l.chance(l.config.Reorder) {
+		l.stats.Reordered++
+		return at.Add(max(l.config.Latency, time.Millisecond))
+	}
+	at = later(at, l.last)
+	l.last = at
+	return at
+}
+
+func (l *link) run() {
+	timer := l.config.Clock.NewTimer(0)
+	defer timer.Stop()
+	for {
+		l.mu.Lock()
+		now := l.config.Clock.Now()
+		for len(l.queue) > 0 && !l.queue[0].at.After(now) {
+			pk := heap.Pop(&l.queue).(*packet)
+			if l.dst.deliver(pk.b) {
+				l.stats.Delivered++
+			} else {
+				l.stats.Dropped++
+			}
+		}
+
+		if len(l.queue) > 0 {
+			timer.Reset(l.queue[0].at.Sub(now))
+		} else {
+			timer.Stop()
+		}
+		l.mu.Unlock()
+
+		select {
+		case <-l.closed:
+			return
+		case <-l.wake:
+		case <-timer.C():
+		}
+	}
+}
+
+func (l *link) snapshot() LinkStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.stats
+}
+
+func (l *link) close() {
+	l.once.Do(func() {
+		close(l.closed)
+	})
+}
+
+func (l *link) chance(probability float64) bool {
+	return probability > 0 && l.rand.Float64() < probability
+}
+
+func later(a, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
+
+type packet struct {
+	b     []byte
+	at    time.Time
+	index uint64
+}
+
+type packetHeap []*packet
+
+func (h packetHeap) Len() int { return len(h) }
+
+func (h packetHeap) Less(i, j int) bool {
+	if h[i].at.Equal(h[j].at) {
+		return h[i].index < h[j].index
+	}
+	return h[i].at.Before(h[j].at)
+}
+
+func (h packetHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *packetHeap) Push(x any) { *h = append(*h, x.(*packet)) }
+
+func (h *packetHeap) Pop() any {
+	old := *h
+	pk := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return pk
+}
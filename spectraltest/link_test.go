@@ -0,0 +1,199 @@
+package spectraltest
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+func read(t *testing.T, c *Conn, timeout time.Duration) ([]byte, error) {
+	t.Helper()
+	_ = c.SetReadDeadline(time.Now().Add(timeout))
+	buf := make([]byte, 65536)
+	n, _, err := c.ReadFrom(buf)
+	return buf[:n], err
+}
+
+func TestPipeDelivers(t *testing.T) {
+	a, b := Pipe(LinkConfig{})
+	defer a.Close()
+	if _, err := a.WriteTo([]byte("ping"), b.LocalAddr()); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := read(t, b, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(p, []byte("ping")) {
+		t.Fatalf("expected ping, got %q", p)
+	}
+}
+
+func TestPipeLatency(t *testing.T) {
+	a, b := Pipe(LinkConfig{Latency: time.Millisecond * 50})
+	defer a.Close()
+	start := time.Now()
+	_, _ = a.WriteTo([]byte("ping"), b.LocalAddr())
+	if _, err := read(t, b, time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	if elapsed := time.Since(start); elapsed < time.Millisecond*50 {
+		t.Fatalf("packet delivered after %v, expected at least 50ms", elapsed)
+	}
+}
+
+func TestPipeBandwidth(t *testing.T) {
+	a, b := Pipe(LinkConfig{Bandwidth: 100_000})
+	defer a.Close()
+	start := time.Now()
+	for range 10 {
+		_, _ = a.WriteTo(make([]byte, 1000), b.LocalAddr())
+	}
+
+	for range 10 {
+		if _, err := read(t, b, time.Second); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if elapsed := time.Since(start); elapsed < time.Millisecond*100 {
+		t.Fatalf("10KB delivered after %v over 100KB/s, expected at least 100ms", elapsed)
+	}
+}
+
+func TestPipeLoss(t *testing.T) {
+	a, b := Pipe(LinkConfig{Loss: 1})
+	defer a.Close()
+	_, _ = a.WriteTo([]byte("ping"), b.LocalAddr())
+	if _, err := read(t, b, time.Millisecond*50); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+
+	if stats := a.Stats(); stats.Lost != 1 || stats.Delivered != 0 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestPipeMTU(t *testing.T) {
+	a, b := Pipe(LinkConfig{MTU: 100})
+	defer a.Close()
+	_, _ = a.WriteTo(make([]byte, 101), b.LocalAddr())
+	_, _ = a.WriteTo(make([]byte, 100), b.LocalAddr())
+	p, err := read(t, b, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(p) != 100 {
+		t.Fatalf("expected 100 byte packet, got %v", len(p))
+	}
+
+	if stats := a.Stats(); stats.Oversized != 1 {
+		t.Fatalf("expected one oversized packet, got %+v", stats)
+	}
+}
+
+func TestPipeDuplicate(t *testing.T) {
+	a, b := Pipe(LinkConfig{Duplicate: 1})
+	defer a.Close()
+	_, _ = a.WriteTo([]byte("ping"), b.LocalAddr())
+	for range 2 {
+		if _, err := read(t, b, time.Second); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestPipeOrdering(t *testing.T) {
+	a, b := Pipe(LinkConfig{Latency: time.Millisecond * 5, Jitter: time.Millisecond * 5})
+	defer a.Close()
+	for i := range 100 {
+		_, _ = a.WriteTo([]byte{byte(i)}, b.LocalAddr())
+	}
+
+	for i := range 100 {
+		p, err := read(t, b, time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if p[0] != byte(i) {
+			t.Fatalf("expected packet %v, got %v", i, p[0])
+		}
+	}
+}
+
+func TestPipeReorder(t *testing.T) {
+	a, b := Pipe(LinkConfig{Latency: time.Millisecond * 5, Reorder: 0.5})
+	defer a.Close()
+	for i := range 100 {
+		_, _ = a.WriteTo([]byte{byte(i)}, b.LocalAddr())
+	}
+
+	reordered := false
+	for i := range 100 {
+		p, err := read(t, b, time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reordered = reordered || p[0] != byte(i)
+	}
+
+	if !reordered {
+		t.Fatal("expected packets to be reordered")
+	}
+}
+
+func TestPipeSeed(t *testing.T) {
+	lost := func() uint64 {
+		a, b := Pipe(LinkConfig{Loss: 0.5, Seed: 42})
+		defer a.Close()
+		for range 100 {
+			_, _ = a.WriteTo([]byte("ping"), b.LocalAddr())
+		}
+		return a.Stats().Lost
+	}
+
+	if first, second := lost(), lost(); first != second {
+		t.Fatalf("same seed lost %v and %v packets", first, second)
+	}
+}
+
+func TestPipeDeadline(t *testing.T) {
+	a, b := Pipe(LinkConfig{})
+	defer a.Close()
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := b.ReadFrom(make([]byte, 10))
+		done <- err
+	}()
+
+	time.Sleep(time.Millisecond * 10)
+	_ = b.SetReadDeadline(time.Now())
+	select {
+	case err := <-done:
+		if !errors.Is(err, os.ErrDeadlineExceeded) {
+			t.Fatalf("expected deadline exceeded, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("changing the deadline did not wake the reader")
+	}
+}
+
+func TestPipeClose(t *testing.T) {
+	a, b := Pipe(LinkConfig{})
+	_ = a.Close()
+	if _, err := a.WriteTo([]byte("ping"), b.LocalAddr()); !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("expected closed error, got %v", err)
+	}
+
+	if _, _, err := a.ReadFrom(make([]byte, 10)); !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("expected closed error, got %v", err)
+	}
+}
@@ -3,82 +3,178 @@ package spectral
 import (
 	"context"
 	"errors"
+	"os"
 	"slices"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/cooldogedev/spectral/internal"
+	"github.com/cooldogedev/spectral/internal/clock"
+	"github.com/cooldogedev/spectral/internal/deadline"
 	"github.com/cooldogedev/spectral/internal/frame"
 	"github.com/cooldogedev/spectral/internal/log"
 	"github.com/cooldogedev/spectral/internal/protocol"
 )
 
+const (
+	DefaultStreamUrgency = 3
+	MaxStreamUrgency     = 7
+)
+
 var streamDataPool = sync.Pool{New: func() any { return &frame.StreamData{} }}
 
 type Stream struct {
-	ctx        context.Context
-	cancelFunc context.CancelCauseFunc
-	streamID   protocol.StreamID
-	wake       func()
-	closer     func()
-	sendQueue  *sendQueue
-	frame      *frameQueue
-	buffer     *internal.RingBuffer[byte]
-	available  chan struct{}
-	sequenceID atomic.Uint32
-	logger     log.Logger
-	mu         sync.Mutex
-	once       sync.Once
-}
-
-func newStream(streamID protocol.StreamID, parentCtx context.Context, sendQueue *sendQueue, wake func(), closer func(), logger log.Logger) *Stream {
+	ctx           context.Context
+	cancelFunc    context.CancelCauseFunc
+	streamID      protocol.StreamID
+	clock         clock.Clock
+	wake          func()
+	closer        func()
+	sendQueue     *sendQueue
+	queue         *streamQueue
+	frame         *frameQueue
+	buffer        *internal.RingBuffer[byte]
+	available     chan struct{}
+	sendWindow    int
+	readDeadline  *deadline.Deadline
+	writeDeadline *deadline.Deadline
+	sequenceID    atomic.Uint32
+	logger        log.Logger
+	mu            sync.Mutex
+	writeMu       sync.Mutex
+	once          sync.Once
+}
+
+func newStream(streamID protocol.StreamID, parentCtx context.Context, clock clock.Clock, window int, sendWindow int, sendQueue *sendQueue, wake func(), closer func(), logger log.Logger) *Stream {
 	ctx, cancelFunc := context.WithCancelCause(parentCtx)
 	return &Stream{
-		ctx:        ctx,
-		cancelFunc: cancelFunc,
-		streamID:   streamID,
-		wake:       wake,
-		closer:     closer,
-		sendQueue:  sendQueue,
-		frame:      newFrameQueue(),
-		buffer:     internal.NewRingBuffer[byte](1024 * 1024),
-		available:  make(chan struct{}, 1),
-		logger:     logger,
+		ctx:           ctx,
+		cancelFunc:    cancelFunc,
+		streamID:      streamID,
+		clock:         clock,
+		wake:          wake,
+		closer:        closer,
+		sendQueue:     sendQueue,
+		queue:         newStreamQueue(),
+		frame:         newFrameQueue(window),
+		buffer:        internal.NewRingBuffer[byte](window),
+		available:     make(chan struct{}, 1),
+		sendWindow:    sendWindow,
+		readDeadline:  deadline.New(clock),
+		writeDeadline: deadline.New(clock),
+		logger:        logger,
 	}
 }
 
 func (s *Stream) Read(p []byte) (int, error) {
-	if n := s.read(p); n > 0 {
-		return n, nil
+	for {
+		if s.readDeadline.Exceeded() {
+			return 0, os.ErrDeadlineExceeded
+		}
+
+		if n := s.read(p); n > 0 {
+			return n, nil
+		}
+
+		if err := s.wait(s.readDeadline, s.available, nil); err != nil {
+			return 0, err
+		}
 	}
+}
 
-	select {
-	case <-s.ctx.Done():
-		return 0, context.Cause(s.ctx)
-	case <-s.available:
-		return s.read(p), nil
+func (s *Stream) Write(p []byte) (n int, err error) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	for n < len(p) {
+		select {
+		case <-s.ctx.Done():
+			return n, context.Cause(s.ctx)
+		case <-s.sendQueue.closing:
+			return n, ErrConnectionClosing
+		default:
+		}
+
+		if s.writeDeadline.Exceeded() {
+			return n, os.ErrDeadlineExceeded
+		}
+
+		mss := int(s.sendQueue.mss()) - 20
+		if written := s.write(p[n:], min(len(p)-n, mss)); written > 0 {
+			n += written
+			continue
+		}
+
+		if err := s.wait(s.writeDeadline, s.queue.writable, s.sendQueue.closing); err != nil {
+			return n, err
+		}
 	}
+	return n, nil
 }
 
-func (s *Stream) Write(p []byte) (int, error) {
+func (s *Stream) TryWrite(p []byte) (int, error) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
 	select {
 	case <-s.ctx.Done():
 		return 0, context.Cause(s.ctx)
+	case <-s.sendQueue.closing:
+		return 0, ErrConnectionClosing
 	default:
 	}
 
+	if s.writeDeadline.Exceeded() {
+		return 0, os.ErrDeadlineExceeded
+	}
+
+	if len(p) == 0 {
+		return 0, nil
+	}
+	return s.write(p, 1), nil
+}
+
+func (s *Stream) write(p []byte, least int) int {
+	n := s.queue.reserve(len(p), least, s.sendWindow)
+	if n == 0 {
+		return 0
+	}
+
 	mss := int(s.sendQueue.mss()) - 20
 	fr := streamDataPool.Get().(*frame.StreamData)
 	fr.StreamID = s.streamID
-	for payload := range slices.Chunk(p, mss) {
+	for payload := range slices.Chunk(p[:n], mss) {
 		fr.SequenceID = s.sequenceID.Add(1) - 1
 		fr.Payload = payload
-		s.sendQueue.add(frame.PackSingle(fr))
+		s.sendQueue.add(s.queue, fr)
 	}
 	fr.Payload = fr.Payload[:0]
 	streamDataPool.Put(fr)
 	s.wake()
-	return len(p), nil
+	return n
+}
+
+func (s *Stream) SetDeadline(t time.Time) error {
+	s.readDeadline.Set(t)
+	s.writeDeadline.Set(t)
+	return nil
+}
+
+func (s *Stream) SetReadDeadline(t time.Time) error {
+	s.readDeadline.Set(t)
+	return nil
+}
+
+func (s *Stream) SetWriteDeadline(t time.Time) error {
+	s.writeDeadline.Set(t)
+	return nil
+}
+
+func (s *Stream) SetPriority(urgency uint8, incremental bool) {
+	s.sendQueue.setPriority(s.queue, urgency, incremental)
+}
+
+func (s *Stream) Priority() (urgency uint8, incremental bool) {
+	return s.sendQueue.priority(s.queue)
 }
 
 func (s *Stream) Context() context.Context {
@@ -87,12 +183,12 @@ func (s *Stream) Context() context.Context {
 
 func (s *Stream) Close() error {
 	s.logger.Log("stream_close_application", "streamID", s.streamID)
-	return s.internalClose("closed by application")
+	return s.internalClose(errors.New("closed by application"))
 }
 
-func (s *Stream) internalClose(message string) error {
+func (s *Stream) internalClose(cause error) error {
 	s.once.Do(func() {
-		s.cancelFunc(errors.New(message))
+		s.cancelFunc(cause)
 		s.closer()
 		s.logger.Log("stream_close", "streamID", s.streamID)
 		s.cleanup()
@@ -103,7 +199,6 @@ func (s *Stream) internalClose(message string) error {
 func (s *Stream) cleanup() {
 	<-s.ctx.Done()
 	s.mu.Lock()
-	s.buffer.Reset()
 	s.frame.clear()
 	s.mu.Unlock()
 }
@@ -126,14 +221,46 @@ func (s *Stream) receive(sequenceID uint32, p []byte) {
 	s.mu.Unlock()
 }
 
+func (s *Stream) accepts(sequenceID uint32, n int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return sequenceID == s.frame.expected && s.buffer.Free() >= n || s.frame.accepts(sequenceID, n)
+}
+
+func (s *Stream) wait(d *deadline.Deadline, ready <-chan struct{}, closing <-chan struct{}) error {
+	remaining, changed := d.Remaining()
+	if remaining <= 0 {
+		return os.ErrDeadlineExceeded
+	}
+
+	var expired <-chan time.Time
+	if remaining != deadline.Inf {
+		timer := s.clock.NewTimer(remaining)
+		defer timer.Stop()
+		expired = timer.C()
+	}
+
+	select {
+	case <-s.ctx.Done():
+		return context.Cause(s.ctx)
+	case <-closing:
+		return ErrConnectionClosing
+	case <-expired:
+		return os.ErrDeadlineExceeded
+	case <-changed:
+	case <-ready:
+	}
+	return nil
+}
+
 func (s *Stream) processFrames() {
 	for {
-		entry := s.frame.top()
-		if entry == nil || len(entry.payload) > s.buffer.Free() {
+		p := s.frame.top()
+		if p == nil || len(p) > s.buffer.Free() {
 			break
 		}
 
-		if _, err := s.buffer.Write(entry.payload); err != nil {
+		if _, err := s.buffer.Write(p); err != nil {
 			break
 		}
 		s.frame.dequeue()
@@ -151,7 +278,8 @@ func (s *Stream) read(p []byte) (n int) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	if s.buffer.Len() > 0 {
-		return s.buffer.Read(p)
+		n = s.buffer.Read(p)
+		s.processFrames()
 	}
 	return
 }
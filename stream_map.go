@@ -31,6 +31,12 @@ func (s *streamMap) get(streamID protocol.StreamID) *Stream {
 	return nil
 }
 
+func (s *streamMap) len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.m)
+}
+
 func (s *streamMap) remove(streamID protocol.StreamID) {
 	s.mu.Lock()
 	delete(s.m, streamID)
@@ -0,0 +1,392 @@
+package spectral
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/cooldogedev/spectral/internal/clock"
+	"github.com/cooldogedev/spectral/internal/frame"
+	"github.com/cooldogedev/spectral/internal/log"
+	"github.com/cooldogedev/spectral/internal/protocol"
+)
+
+func newTestStream(window int) (*Stream, *sendQueue, *bool) {
+	queue := newSendQueue(newPacketPool(protocol.MaxPacketSize))
+	closed := new(bool)
+	return newStream(1, context.Background(), clock.Wall, window, defaultStreamSendWindow, queue, func() {}, func() { *closed = true }, log.NopLogger{}), queue, closed
+}
+
+func TestStreamReceiveInOrder(t *testing.T) {
+	s, _, _ := newTestStream(1024)
+	s.receive(0, []byte("hello "))
+	s.receive(1, []byte("world"))
+	buf := make([]byte, 64)
+	n, err := s.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(buf[:n]) != "hello world" {
+		t.Fatalf("expected %q, got %q", "hello world", buf[:n])
+	}
+}
+
+func TestStreamReceiveOutOfOrder(t *testing.T) {
+	s, _, _ := newTestStream(1024)
+	s.receive(2, []byte("c"))
+	s.receive(1, []byte("b"))
+	buf := make([]byte, 64)
+	if n := s.read(buf); n != 0 {
+		t.Fatalf("read %q before the first segment arrived", buf[:n])
+	}
+
+	s.receive(0, []byte("a"))
+	n, err := s.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(buf[:n]) != "abc" {
+		t.Fatalf("expected %q, got %q", "abc", buf[:n])
+	}
+}
+
+func TestStreamReceiveDuplicate(t *testing.T) {
+	s, _, _ := newTestStream(1024)
+	s.receive(0, []byte("a"))
+	s.receive(0, []byte("a"))
+	s.receive(2, []byte("c"))
+	s.receive(2, []byte("c"))
+	s.receive(1, []byte("b"))
+	s.receive(3, []byte("d"))
+	buf := make([]byte, 64)
+	if n := s.read(buf); string(buf[:n]) != "abcd" {
+		t.Fatalf("expected %q, got %q", "abcd", buf[:n])
+	}
+}
+
+func TestStreamReceiveWindowFull(t *testing.T) {
+	s, _, _ := newTestStream(4)
+	s.receive(0, []byte("abcd"))
+	s.receive(1, []byte("ef"))
+	buf := make([]byte, 64)
+	if n := s.read(buf); string(buf[:n]) != "abcd" {
+		t.Fatalf("expected %q, got %q", "abcd", buf[:n])
+	}
+
+	if n := s.read(buf); string(buf[:n]) != "ef" {
+		t.Fatalf("expected queued segment after a read freed the window, got %q", buf[:n])
+	}
+}
+
+func TestStreamReceiveOutsideWindow(t *testing.T) {
+	s, _, _ := newTestStream(4)
+	s.receive(0, []byte("abcd"))
+	if !s.accepts(1, 4) || s.accepts(2, 5) || s.accepts(5, 1) {
+		t.Fatal("expected only segments inside the receive window to be accepted")
+	}
+
+	payload := []byte("efgh")
+	s.receive(1, payload)
+	s.receive(5, []byte("x"))
+	payload[0] = 'z'
+	if s.accepts(2, 1) {
+		t.Fatal("expected a full receive window to refuse further segments")
+	}
+
+	if len(s.frame.segments) != 1 || cap(s.frame.segments[1]) != len(payload) {
+		t.Fatalf("expected a single payload-sized segment, got %v", s.frame.segments)
+	}
+
+	buf := make([]byte, 64)
+	if n := s.read(buf); string(buf[:n]) != "abcd" {
+		t.Fatalf("expected %q, got %q", "abcd", buf[:n])
+	}
+
+	if n := s.read(buf); string(buf[:n]) != "efgh" {
+		t.Fatalf("expected the stored segment to be copied, got %q", buf[:n])
+	}
+}
+
+func TestStreamReadBlocksUntilData(t *testing.T) {
+	s, _, _ := newTestStream(1024)
+	go func() {
+		time.Sleep(time.Millisecond * 10)
+		s.receive(0, []byte("late"))
+	}()
+
+	buf := make([]byte, 64)
+	n, err := s.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(buf[:n]) != "late" {
+		t.Fatalf("expected %q, got %q", "late", buf[:n])
+	}
+}
+
+func TestStreamWriteSegments(t *testing.T) {
+	s, queue, _ := newTestStream(1024)
+	payload := bytes.Repeat([]byte{1}, 3000)
+	if _, err := s.Write(payload); err != nil {
+		t.Fatal(err)
+	}
+
+	var received []byte
+	for i, entry := range s.queue.queue {
+		if uint64(len(entry.b)) > queue.mss() {
+			t.Fatalf("segment %v of %v bytes exceeds mss %v", i, len(entry.b), queue.mss())
+		}
+
+		var reader frame.Reader
+		decoded, _, err := reader.Next(entry.b)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		fr := decoded.(*frame.StreamData)
+		if fr.SequenceID != uint32(i) {
+			t.Fatalf("expected sequence %v, got %v", i, fr.SequenceID)
+		}
+		received = append(received, fr.Payload...)
+	}
+
+	if !bytes.Equal(payload, received) {
+		t.Fatal("segments do not reassemble into the written payload")
+	}
+}
+
+func TestStreamClose(t *testing.T) {
+	s, _, closed := newTestStream(1024)
+	_ = s.Close()
+	if !*closed {
+		t.Fatal("closer was not called")
+	}
+
+	if _, err := s.Write([]byte("x")); err == nil {
+		t.Fatal("expected write on closed stream to fail")
+	}
+
+	if _, err := s.Read(make([]byte, 1)); err == nil {
+		t.Fatal("expected read on closed stream to fail")
+	}
+}
+
+func newSendWindowStream(sendWindow int) (*Stream, *sendQueue) {
+	queue := newSendQueue(newPacketPool(protocol.MaxPacketSize))
+	return newStream(1, context.Background(), clock.Wall, 1024, sendWindow, queue, func() {}, func() {}, log.NopLogger{}), queue
+}
+
+func acknowledgeAll(queue *sendQueue) {
+	for queue.available() {
+		pk := queue.pack(math.MaxUint64)
+		queue.flush()
+		pk.release()
+	}
+}
+
+func TestStreamWriteBlocksUntilAcknowledged(t *testing.T) {
+	s, queue := newSendWindowStream(2048)
+	written := make(chan error, 1)
+	go func() {
+		_, err := s.Write(make([]byte, 4096))
+		written <- err
+	}()
+
+	select {
+	case err := <-written:
+		t.Fatalf("write returned before the send window drained: %v", err)
+	case <-time.After(time.Millisecond * 50):
+	}
+
+	if buffered := s.queue.buffered.Load(); buffered != 2048 {
+		t.Fatalf("expected 2048 buffered bytes, got %v", buffered)
+	}
+
+	for {
+		acknowledgeAll(queue)
+		select {
+		case err := <-written:
+			if err != nil {
+				t.Fatal(err)
+			}
+			return
+		case <-time.After(time.Millisecond * 10):
+		}
+	}
+}
+
+func TestStreamTryWrite(t *testing.T) {
+	s, queue := newSendWindowStream(1000)
+	if n, err := s.TryWrite(make([]byte, 1500)); err != nil || n != 1000 {
+		t.Fatalf("expected 1000 bytes accepted, got %v, %v", n, err)
+	}
+
+	if n, err := s.TryWrite([]byte("x")); err != nil || n != 0 {
+		t.Fatalf("expected a full send window to accept nothing, got %v, %v", n, err)
+	}
+
+	acknowledgeAll(queue)
+	if n, err := s.TryWrite(make([]byte, 500)); err != nil || n != 500 {
+		t.Fatalf("expected 500 bytes accepted after acknowledgement, got %v, %v", n, err)
+	}
+}
+
+func TestStreamWriteUnblocksOnClose(t *testing.T) {
+	s, _ := newSendWindowStream(1000)
+	if n, err := s.TryWrite(make([]byte, 1000)); err != nil || n != 1000 {
+		t.Fatalf("expected the send window to be filled, got %v, %v", n, err)
+	}
+
+	written := make(chan error, 1)
+	go func() {
+		_, err := s.Write(make([]byte, 500))
+		written <- err
+	}()
+
+	_ = s.internalClose(errors.New("closed by connection"))
+	select {
+	case err := <-written:
+		if err == nil {
+			t.Fatal("expected the blocked write to fail after close")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("write did not unblock after close")
+	}
+}
+
+func TestStreamReadDeadline(t *testing.T) {
+	s, _, _ := newTestStream(1024)
+	_ = s.SetReadDeadline(time.Now().Add(time.Millisecond * 20))
+	start := time.Now()
+	if _, err := s.Read(make([]byte, 1)); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed < time.Millisecond*20 {
+		t.Fatalf("read returned after %v, before the deadline", elapsed)
+	}
+
+	s.receive(0, []byte("a"))
+	if _, err := s.Read(make([]byte, 1)); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("expected an exceeded deadline to fail reads with buffered data, got %v", err)
+	}
+
+	_ = s.SetReadDeadline(time.Time{})
+	if n, err := s.Read(make([]byte, 1)); err != nil || n != 1 {
+		t.Fatalf("expected buffered data after clearing the deadline, got %v, %v", n, err)
+	}
+}
+
+func TestStreamDeadlineWakesBlockedCalls(t *testing.T) {
+	s, _ := newSendWindowStream(1000)
+	if _, err := s.TryWrite(make([]byte, 1000)); err != nil {
+		t.Fatal(err)
+	}
+
+	read, written := make(chan error, 1), make(chan error, 1)
+	go func() {
+		_, err := s.Read(make([]byte, 1))
+		read <- err
+	}()
+	go func() {
+		_, err := s.Write([]byte("x"))
+		written <- err
+	}()
+
+	_ = s.SetDeadline(time.Now().Add(time.Hour))
+	time.Sleep(time.Millisecond * 10)
+	_ = s.SetDeadline(time.Now().Add(-time.Second))
+	for _, ch := range []chan error{read, written} {
+		select {
+		case err := <-ch:
+			if !errors.Is(err, os.ErrDeadlineExceeded) {
+				t.Fatalf("expected deadline exceeded, got %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("changing the deadline did not wake a blocked call")
+		}
+	}
+
+	if _, err := s.TryWrite([]byte("x")); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+}
+
+func TestStreamDeadlineExtended(t *testing.T) {
+	s, _, _ := newTestStream(1024)
+	_ = s.SetReadDeadline(time.Now().Add(time.Millisecond * 20))
+	read := make(chan error, 1)
+	go func() {
+		_, err := s.Read(make([]byte, 1))
+		read <- err
+	}()
+
+	_ = s.SetReadDeadline(time.Time{})
+	select {
+	case err := <-read:
+		t.Fatalf("read returned after the deadline was cleared: %v", err)
+	case <-time.After(time.Millisecond * 50):
+	}
+
+	s.receive(0, []byte("a"))
+	if err := <-read; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStreamReadAfterCloseReturnsBufferedData(t *testing.T) {
+	s, _, _ := newTestStream(1024)
+	s.receive(0, []byte("tail"))
+	_ = s.internalClose(errors.New("closed by connection"))
+	buf := make([]byte, 64)
+	n, err := s.Read(buf)
+	if err != nil || string(buf[:n]) != "tail" {
+		t.Fatalf("expected buffered data, got %q, %v", buf[:n], err)
+	}
+}
+
+func benchmarkStreamReceive(b *testing.B, reorder bool) {
+	const segments = 64
+	s, _, _ := newTestStream(1024 * 1024)
+	payload := make([]byte, 1200)
+	buf := make([]byte, 64*1024)
+	order := make([]uint32, segments)
+	for i := range order {
+		order[i] = uint32(i)
+		if reorder {
+			order[i] = uint32(i ^ 7)
+		}
+	}
+
+	b.SetBytes(int64(len(payload) * segments))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := range b.N {
+		base := uint32(i * segments)
+		for _, offset := range order {
+			s.receive(base+offset, payload)
+		}
+
+		for s.read(buf) > 0 {
+		}
+	}
+}
+
+func BenchmarkStreamReceive(b *testing.B) {
+	b.Run("InOrder", func(b *testing.B) { benchmarkStreamReceive(b, false) })
+	b.Run("Reordered", func(b *testing.B) { benchmarkStreamReceive(b, true) })
+}
+
+func BenchmarkNewStream(b *testing.B) {
+	b.ReportAllocs()
+	for range b.N {
+		newTestStream(1024 * 1024)
+	}
+}
@@ -0,0 +1,177 @@
+package spectral
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand/v2"
+	"net"
+	"sync"
+
+	"github.com/cooldogedev/spectral/internal/frame"
+	"github.com/cooldogedev/spectral/internal/log"
+	"github.com/cooldogedev/spectral/internal/protocol"
+)
+
+type Transport struct {
+	config     *Config
+	conn       *udpConn
+	listener   *Listener
+	dialed     map[protocol.ConnectionID]*ClientConnection
+	closed     bool
+	logger     log.Logger
+	mu         sync.Mutex
+	ctx        context.Context
+	cancelFunc context.CancelFunc
+	once       sync.Once
+}
+
+func NewTransport(address string, config *Config) (*Transport, error) {
+	config, err := populateConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	addr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	uConn, err := newUDPConn(conn, true, config.MaxUDPPayloadSize)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	t := &Transport{
+		config: config,
+		conn:   uConn,
+		dialed: make(map[protocol.ConnectionID]*ClientConnection),
+		logger: log.NewLogger(log.PerspectiveClient),
+	}
+	t.logger.SetConnectionID(-1)
+	t.ctx, t.cancelFunc = context.WithCancel(context.Background())
+	go t.read()
+	return t, nil
+}
+
+func (t *Transport) LocalAddr() net.Addr {
+	return t.conn.LocalAddr()
+}
+
+func (t *Transport) Dial(ctx context.Context, address string) (Connection, error) {
+	addr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return nil, errors.New("transport closed")
+	}
+
+	connectionID := t.handshakeID()
+	c := newClientConnection(t.conn, addr, connectionID, t.ctx, t.config)
+	t.dialed[connectionID] = c
+	t.mu.Unlock()
+	go func() {
+		<-c.done
+		t.mu.Lock()
+		delete(t.dialed, connectionID)
+		t.mu.Unlock()
+	}()
+	return handshake(ctx, c, func() {})
+}
+
+func (t *Transport) Listen() (*Listener, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return nil, errors.New("transport closed")
+	}
+
+	if t.listener != nil {
+		return nil, errors.New("transport is already listening")
+	}
+	t.listener = newListener([]*udpConn{t.conn}, t.config, true)
+	return t.listener, nil
+}
+
+func (t *Transport) Close() (err error) {
+	t.once.Do(func() {
+		t.mu.Lock()
+		listener := t.listener
+		dialed := make([]*ClientConnection, 0, len(t.dialed))
+		for _, c := range t.dialed {
+			dialed = append(dialed, c)
+		}
+		t.closed = true
+		t.mu.Unlock()
+
+		if listener != nil {
+			_ = listener.Close()
+		}
+
+		var wg sync.WaitGroup
+		for _, c := range dialed {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_ = c.CloseWithError(frame.ConnectionCloseGraceful, "closed transport")
+			}()
+		}
+		wg.Wait()
+		t.cancelFunc()
+		t.logger.Close()
+		err = t.conn.conn.Close()
+	})
+	return
+}
+
+func (t *Transport) read() {
+	var reader frame.Reader
+	t.conn.Read(func(dgram *datagram) (err error) {
+		connectionID, sequenceID, frameID, err := unpack(&reader, dgram.b, t.logger)
+		if err != nil {
+			dgram.reset()
+			return nil
+		}
+
+		t.mu.Lock()
+		c, ok := t.dialed[connectionID]
+		listener := t.listener
+		t.mu.Unlock()
+		if ok && addrEqual(c.RemoteAddr(), dgram.peerAddr) {
+			select {
+			case <-c.done:
+				dgram.reset()
+			default:
+				c.bytesReceived.Add(uint64(len(dgram.b)))
+				c.deliver(newReceivedPacket(dgram, sequenceID, c.clock.Now()))
+			}
+			return nil
+		}
+
+		if listener != nil {
+			_ = listener.route(listener.shards[0], connectionID).receive(&reader, connectionID, sequenceID, frameID, dgram)
+		} else {
+			dgram.reset()
+		}
+		return nil
+	})
+}
+
+func (t *Transport) handshakeID() protocol.ConnectionID {
+	for {
+		connectionID := -protocol.ConnectionID(rand.Int64N(math.MaxInt64-1) + 2)
+		if _, ok := t.dialed[connectionID]; !ok {
+			return connectionID
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package spectral
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+)
+
+func echo(t *testing.T, ctx context.Context, client Connection, listener *Listener, payload string) {
+	t.Helper()
+	server, serverStream, clientStream := acceptStream(t, ctx, listener, client)
+	if server.RemoteAddr().String() != client.LocalAddr().String() {
+		t.Fatalf("expected the server to see %v, got %v", client.LocalAddr(), server.RemoteAddr())
+	}
+
+	if _, err := clientStream.Write([]byte(payload)); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, len(payload))
+	if _, err := io.ReadFull(serverStream, buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if string(buf) != payload {
+		t.Fatalf("expected %q, got %q", payload, buf)
+	}
+}
+
+func TestTransportManyDials(t *testing.T) {
+	listener, err := Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	transport, err := NewTransport("127.0.0.1:0", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer transport.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	conns := make([]Connection, 8)
+	for i := range conns {
+		if conns[i], err = transport.Dial(ctx, listener.Addr().String()); err != nil {
+			t.Fatal(err)
+		}
+
+		if conns[i].LocalAddr().String() != transport.LocalAddr().String() {
+			t.Fatalf("expected every connection to share %v, got %v", transport.LocalAddr(), conns[i].LocalAddr())
+		}
+	}
+
+	for i, conn := range conns {
+		echo(t, ctx, conn, listener, string(rune('a'+i)))
+	}
+}
+
+func TestTransportPeerToPeer(t *testing.T) {
+	var (
+		transports [2]*Transport
+		listeners  [2]*Listener
+	)
+	for i := range transports {
+		transport, err := NewTransport("127.0.0.1:0", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer transport.Close()
+
+		listener, err := transport.Listen()
+		if err != nil {
+			t.Fatal(err)
+		}
+		transports[i], listeners[i] = transport, listener
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	dialed := make(chan Connection, 1)
+	go func() {
+		conn, err := transports[1].Dial(ctx, transports[0].LocalAddr().String())
+		if err != nil {
+			t.Error(err)
+		}
+		dialed <- conn
+	}()
+
+	conn, err := transports[0].Dial(ctx, transports[1].LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reverse := <-dialed
+	if reverse == nil {
+		t.FailNow()
+	}
+	echo(t, ctx, conn, listeners[1], "ping")
+	echo(t, ctx, reverse, listeners[0], "pong")
+}
@@ -2,31 +2,48 @@ package spectral
 
 import (
 	"net"
+	"sync/atomic"
+	"syscall"
 
 	"github.com/cooldogedev/spectral/internal/protocol"
 )
 
 type udpConn struct {
-	conn     *net.UDPConn
-	ecn      bool
-	mtud     bool
-	listener bool
+	conn   net.PacketConn
+	pool   *datagramPool
+	ecn    bool
+	mtud   bool
+	shared atomic.Bool
 }
 
-func newUDPConn(conn *net.UDPConn, listener bool) (*udpConn, error) {
-	if err := conn.SetReadBuffer(protocol.ReceiveBufferSize); err != nil {
-		return nil, err
+func newUDPConn(conn net.PacketConn, shared bool, maxPayloadSize int) (*udpConn, error) {
+	c := &udpConn{conn: conn, pool: newDatagramPool(maxPayloadSize)}
+	c.shared.Store(shared)
+	if conn, ok := conn.(interface{ SetReadBuffer(bytes int) error }); ok {
+		if err := conn.SetReadBuffer(protocol.ReceiveBufferSize); err != nil {
+			return nil, err
+		}
 	}
 
-	if err := conn.SetWriteBuffer(protocol.SendBufferSize); err != nil {
-		return nil, err
+	if conn, ok := conn.(interface{ SetWriteBuffer(bytes int) error }); ok {
+		if err := conn.SetWriteBuffer(protocol.SendBufferSize); err != nil {
+			return nil, err
+		}
+	}
+
+	if conn, ok := conn.(interface{ DontFragment() bool }); ok {
+		c.mtud = conn.DontFragment()
+		return c, nil
+	}
+
+	if _, ok := conn.(*net.UDPConn); !ok {
+		return c, nil
 	}
 
-	sc, err := conn.SyscallConn()
+	sc, err := conn.(syscall.Conn).SyscallConn()
 	if err != nil {
 		return nil, err
 	}
-	c := &udpConn{conn: conn, listener: listener}
 	c.mtud, c.ecn = setOpts(sc)
 	return c, nil
 }
@@ -37,8 +54,8 @@ func (c *udpConn) LocalAddr() net.Addr {
 
 func (c *udpConn) Read(f func(d *datagram) error) {
 	for {
-		dgram := newDatagram()
-		n, addr, err := c.conn.ReadFromUDP(dgram.b)
+		dgram := c.pool.get()
+		n, addr, err := c.conn.ReadFrom(dgram.b)
 		if err != nil && !isRecvMsgSizeErr(err) {
 			return
 		}
@@ -55,8 +72,8 @@ func (c *udpConn) Read(f func(d *datagram) error) {
 	}
 }
 
-func (c *udpConn) Write(p []byte, addr *net.UDPAddr) (int, error) {
-	n, err := c.conn.WriteToUDP(p, addr)
+func (c *udpConn) Write(p []byte, addr net.Addr) (int, error) {
+	n, err := c.conn.WriteTo(p, addr)
 	if err != nil && !isSendMsgSizeErr(err) {
 		return 0, err
 	}
@@ -64,8 +81,22 @@ func (c *udpConn) Write(p []byte, addr *net.UDPAddr) (int, error) {
 }
 
 func (c *udpConn) Close() error {
-	if c.listener {
+	if c.shared.Load() {
 		return nil
 	}
 	return c.conn.Close()
 }
+
+func (c *udpConn) supportsMigration() bool {
+	_, ok := c.conn.(*net.UDPConn)
+	return ok && !c.shared.Load()
+}
+
+func addrEqual(a, b net.Addr) bool {
+	if a, ok := a.(*net.UDPAddr); ok {
+		if b, ok := b.(*net.UDPAddr); ok {
+			return a.Port == b.Port && a.IP.Equal(b.IP) && a.Zone == b.Zone
+		}
+	}
+	return a.Network() == b.Network() && a.String() == b.String()
+}
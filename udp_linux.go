@@ -9,6 +9,17 @@ import (
 	"golang.org/x/sys/unix"
 )
 
+const reusePortSupported = true
+
+func setReusePort(conn syscall.RawConn) (err error) {
+	if ctrlErr := conn.Control(func(fd uintptr) {
+		err = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+	}); ctrlErr != nil {
+		return ctrlErr
+	}
+	return
+}
+
 func setOpts(conn syscall.RawConn) (mtud, ecn bool) {
 	_ = conn.Control(func(fd uintptr) {
 		if err := unix.SetsockoptInt(int(fd), unix.IPPROTO_IP, unix.IP_MTU_DISCOVER, unix.IP_PMTUDISC_DO); err == nil {
@@ -2,7 +2,16 @@
 
 package spectral
 
-import "syscall"
+import (
+	"errors"
+	"syscall"
+)
+
+const reusePortSupported = false
+
+func setReusePort(_ syscall.RawConn) error {
+	return errors.New("SO_REUSEPORT is not supported on this platform")
+}
 
 func setOpts(conn syscall.RawConn) (mtud, ecn bool) {
 	return
@@ -0,0 +1,84 @@
+package spectral
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cooldogedev/spectral/internal/log"
+	"github.com/cooldogedev/spectral/internal/protocol"
+	"github.com/cooldogedev/spectral/spectraltest"
+)
+
+func TestUDPConnMTUDiscovery(t *testing.T) {
+	conn, err := newUDPConn(&discardPacketConn{closed: make(chan struct{})}, false, protocol.MaxUDPPayloadSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if conn.mtud {
+		t.Fatal("expected MTU discovery to be disabled for a generic packet conn")
+	}
+
+	a, b := spectraltest.Pipe(spectraltest.LinkConfig{})
+	defer a.Close()
+	if conn, err = newUDPConn(b, false, protocol.MaxUDPPayloadSize); err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if !conn.mtud {
+		t.Fatal("expected MTU discovery for a conn that never fragments")
+	}
+}
+
+type recordingLogger struct {
+	log.NopLogger
+	events []string
+}
+
+func (r *recordingLogger) Log(event string, _ ...any) {
+	r.events = append(r.events, event)
+}
+
+func TestRecoverDecodePanic(t *testing.T) {
+	logger := &recordingLogger{}
+	err := func() (err error) {
+		defer recoverDecode(logger, &err)
+		panic("malformed frame")
+	}()
+	if err == nil || !strings.Contains(err.Error(), "malformed frame") {
+		t.Fatalf("expected the panic to surface as an error, got %v", err)
+	}
+
+	if len(logger.events) != 1 || logger.events[0] != "decode_panic" {
+		t.Fatalf("expected a decode_panic event, got %v", logger.events)
+	}
+}
+
+func TestUDPConnHandlerPanicPropagates(t *testing.T) {
+	a, b := spectraltest.Pipe(spectraltest.LinkConfig{})
+	defer a.Close()
+	conn, err := newUDPConn(b, false, protocol.MaxUDPPayloadSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	recovered := make(chan any, 1)
+	go func() {
+		defer func() { recovered <- recover() }()
+		conn.Read(func(*datagram) error { panic("handler bug") })
+	}()
+
+	_, _ = a.WriteTo([]byte{0}, b.LocalAddr())
+	select {
+	case v := <-recovered:
+		if v != "handler bug" {
+			t.Fatalf("expected the handler panic to reach the read goroutine, got %v", v)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("handler was not called")
+	}
+}
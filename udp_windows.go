@@ -11,6 +11,12 @@ import (
 
 const IP_DONTFRAGMENT = 14
 
+const reusePortSupported = false
+
+func setReusePort(_ syscall.RawConn) error {
+	return errors.New("SO_REUSEPORT is not supported on this platform")
+}
+
 func setOpts(conn syscall.RawConn) (mtud, ecn bool) {
 	_ = conn.Control(func(fd uintptr) {
 		if err := windows.SetsockoptInt(windows.Handle(fd), windows.IPPROTO_IP, IP_DONTFRAGMENT, 1); err == nil {
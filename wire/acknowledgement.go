@@ -1,12 +1,16 @@
-package frame
+package wire
 
 import (
 	"encoding/binary"
 	"errors"
 )
 
+// AcknowledgementRange is an inclusive range of acknowledged sequence IDs.
 type AcknowledgementRange [2]uint32
 
+// Acknowledgement acknowledges received packets. Max is the largest sequence
+// ID received and Delay is the time in microseconds it was held before being
+// acknowledged.
 type Acknowledgement struct {
 	Delay  int64
 	Max    uint32
@@ -18,17 +22,18 @@ func (fr *Acknowledgement) ID() uint32 {
 }
 
 func (fr *Acknowledgement) Encode() []byte {
-	rangeCount := uint32(len(fr.Ranges))
-	p := make([]byte, 8+4+4+rangeCount*8)
-	binary.LittleEndian.PutUint64(p[0:8], uint64(fr.Delay))
-	binary.LittleEndian.PutUint32(p[8:12], fr.Max)
-	binary.LittleEndian.PutUint32(p[12:16], rangeCount)
-	for i, r := range fr.Ranges {
-		offset := 16 + i*8
-		binary.LittleEndian.PutUint32(p[offset:offset+4], r[0])
-		binary.LittleEndian.PutUint32(p[offset+4:offset+8], r[1])
+	return fr.AppendEncode(nil)
+}
+
+func (fr *Acknowledgement) AppendEncode(dst []byte) []byte {
+	dst = binary.LittleEndian.AppendUint64(dst, uint64(fr.Delay))
+	dst = binary.LittleEndian.AppendUint32(dst, fr.Max)
+	dst = binary.LittleEndian.AppendUint32(dst, uint32(len(fr.Ranges)))
+	for _, r := range fr.Ranges {
+		dst = binary.LittleEndian.AppendUint32(dst, r[0])
+		dst = binary.LittleEndian.AppendUint32(dst, r[1])
 	}
-	return p
+	return dst
 }
 
 func (fr *Acknowledgement) Decode(p []byte) (int, error) {
@@ -39,10 +44,13 @@ func (fr *Acknowledgement) Decode(p []byte) (int, error) {
 	fr.Delay = int64(binary.LittleEndian.Uint64(p[0:8]))
 	fr.Max = binary.LittleEndian.Uint32(p[8:12])
 	length := binary.LittleEndian.Uint32(p[12:16])
-	if len(p) < 16+int(length)*8 {
+	if uint64(len(p)) < 16+uint64(length)*8 {
 		return 0, errors.New("not enough data to decode ranges")
 	}
 
+	if cap(fr.Ranges) < int(length) {
+		fr.Ranges = make([]AcknowledgementRange, length)
+	}
 	fr.Ranges = fr.Ranges[:length]
 	for i := uint32(0); i < length; i++ {
 		offset := 16 + i*8
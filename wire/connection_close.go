@@ -1,10 +1,11 @@
-package frame
+package wire
 
 import (
 	"encoding/binary"
 	"errors"
 )
 
+// Connection close codes.
 const (
 	ConnectionCloseApplication = iota
 	ConnectionCloseGraceful
@@ -12,6 +13,7 @@ const (
 	ConnectionCloseInternal
 )
 
+// ConnectionClose terminates a connection with a code and a message.
 type ConnectionClose struct {
 	Code    byte
 	Message string
@@ -22,12 +24,13 @@ func (fr *ConnectionClose) ID() uint32 {
 }
 
 func (fr *ConnectionClose) Encode() []byte {
-	messageLength := uint32(len(fr.Message))
-	p := make([]byte, 1+4+messageLength)
-	p[0] = fr.Code
-	binary.LittleEndian.PutUint32(p[1:5], messageLength)
-	copy(p[5:], fr.Message)
-	return p
+	return fr.AppendEncode(nil)
+}
+
+func (fr *ConnectionClose) AppendEncode(dst []byte) []byte {
+	dst = append(dst, fr.Code)
+	dst = binary.LittleEndian.AppendUint32(dst, uint32(len(fr.Message)))
+	return append(dst, fr.Message...)
 }
 
 func (fr *ConnectionClose) Decode(p []byte) (int, error) {
@@ -37,7 +40,7 @@ func (fr *ConnectionClose) Decode(p []byte) (int, error) {
 
 	fr.Code = p[0]
 	messageLength := binary.LittleEndian.Uint32(p[1:5])
-	if len(p) < int(5+messageLength) {
+	if uint64(len(p)) < 5+uint64(messageLength) {
 		return 0, errors.New("not enough data to decode message")
 	}
 	fr.Message = string(p[5 : 5+messageLength])
@@ -0,0 +1,49 @@
+package wire
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// ConnectionRequest opens a connection. Token echoes a Retry token when the
+// server requires address validation.
+type ConnectionRequest struct {
+	Version    uint32
+	Token      []byte
+	Parameters TransportParameters
+}
+
+func (fr *ConnectionRequest) ID() uint32 {
+	return IDConnectionRequest
+}
+
+func (fr *ConnectionRequest) Encode() []byte {
+	return fr.AppendEncode(nil)
+}
+
+func (fr *ConnectionRequest) AppendEncode(dst []byte) []byte {
+	dst = binary.LittleEndian.AppendUint32(dst, fr.Version)
+	dst = binary.LittleEndian.AppendUint32(dst, uint32(len(fr.Token)))
+	dst = append(dst, fr.Token...)
+	return fr.Parameters.AppendEncode(dst)
+}
+
+func (fr *ConnectionRequest) Decode(p []byte) (int, error) {
+	if len(p) < 8 {
+		return 0, errors.New("not enough data to decode")
+	}
+
+	fr.Version = binary.LittleEndian.Uint32(p[0:4])
+	tokenLength := binary.LittleEndian.Uint32(p[4:8])
+	if uint64(len(p)) < 8+uint64(tokenLength) {
+		return 0, errors.New("not enough data to decode token")
+	}
+	fr.Token = append(fr.Token[:0], p[8:8+tokenLength]...)
+	n, err := fr.Parameters.Decode(p[8+tokenLength:])
+	if err != nil {
+		return 0, err
+	}
+	return 8 + int(tokenLength) + n, nil
+}
+
+func (fr *ConnectionRequest) Reset() {}
@@ -0,0 +1,61 @@
+package wire
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Connection response codes.
+const (
+	ConnectionResponseSuccess = iota
+	ConnectionResponseFailed
+)
+
+// ConnectionResponse answers a ConnectionRequest. On success ConnectionID is
+// the ID the client uses from then on, on failure Reason explains why.
+type ConnectionResponse struct {
+	ConnectionID ConnectionID
+	Response     byte
+	Version      uint32
+	Reason       string
+	Parameters   TransportParameters
+}
+
+func (fr *ConnectionResponse) ID() uint32 {
+	return IDConnectionResponse
+}
+
+func (fr *ConnectionResponse) Encode() []byte {
+	return fr.AppendEncode(nil)
+}
+
+func (fr *ConnectionResponse) AppendEncode(dst []byte) []byte {
+	dst = binary.LittleEndian.AppendUint64(dst, uint64(fr.ConnectionID))
+	dst = append(dst, fr.Response)
+	dst = binary.LittleEndian.AppendUint32(dst, fr.Version)
+	dst = binary.LittleEndian.AppendUint32(dst, uint32(len(fr.Reason)))
+	dst = append(dst, fr.Reason...)
+	return fr.Parameters.AppendEncode(dst)
+}
+
+func (fr *ConnectionResponse) Decode(p []byte) (int, error) {
+	if len(p) < 17 {
+		return 0, errors.New("not enough data to decode")
+	}
+
+	fr.ConnectionID = ConnectionID(binary.LittleEndian.Uint64(p[0:8]))
+	fr.Response = p[8]
+	fr.Version = binary.LittleEndian.Uint32(p[9:13])
+	reasonLength := binary.LittleEndian.Uint32(p[13:17])
+	if uint64(len(p)) < 17+uint64(reasonLength) {
+		return 0, errors.New("not enough data to decode reason")
+	}
+	fr.Reason = string(p[17 : 17+reasonLength])
+	n, err := fr.Parameters.Decode(p[17+reasonLength:])
+	if err != nil {
+		return 0, err
+	}
+	return 17 + int(reasonLength) + n, nil
+}
+
+func (fr *ConnectionResponse) Reset() {}
@@ -0,0 +1,92 @@
+package wire
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Frame is implemented by every frame type. Encode and AppendEncode produce
+// the frame body without its ID, Decode reads a body and reports how many
+// bytes it consumed, and Reset prepares a frame for reuse.
+type Frame interface {
+	ID() uint32
+	Encode() []byte
+	AppendEncode(dst []byte) []byte
+	Decode(p []byte) (int, error)
+	Reset()
+}
+
+// NewFrame returns an empty frame for the given frame ID.
+func NewFrame(id uint32) (Frame, error) {
+	switch id {
+	case IDAcknowledgement:
+		return &Acknowledgement{}, nil
+	case IDConnectionRequest:
+		return &ConnectionRequest{}, nil
+	case IDConnectionResponse:
+		return &ConnectionResponse{}, nil
+	case IDConnectionClose:
+		return &ConnectionClose{}, nil
+	case IDStreamClose:
+		return &StreamClose{}, nil
+	case IDStreamData:
+		return &StreamData{}, nil
+	case IDStreamRequest:
+		return &StreamRequest{}, nil
+	case IDStreamResponse:
+		return &StreamResponse{}, nil
+	case IDMTURequest:
+		return &MTURequest{}, nil
+	case IDMTUResponse:
+		return &MTUResponse{}, nil
+	case IDPathChallenge:
+		return &PathChallenge{}, nil
+	case IDPathResponse:
+		return &PathResponse{}, nil
+	case IDPing:
+		return &Ping{}, nil
+	case IDPadding:
+		return &Padding{}, nil
+	case IDRetry:
+		return &Retry{}, nil
+	case IDGoAway:
+		return &GoAway{}, nil
+	default:
+		return nil, fmt.Errorf("unknown frame: %v", id)
+	}
+}
+
+// ParseFrameID reads the frame ID at the start of p without decoding the body.
+func ParseFrameID(p []byte) (uint32, error) {
+	if len(p) < 4 {
+		return 0, errors.New("not enough data to decode frame id")
+	}
+	return binary.LittleEndian.Uint32(p[0:4]), nil
+}
+
+// ParseFrame decodes the frame at the start of p and returns it together with
+// the number of bytes consumed, including the frame ID.
+func ParseFrame(p []byte) (Frame, int, error) {
+	id, err := ParseFrameID(p)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	fr, err := NewFrame(id)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	n, err := fr.Decode(p[4:])
+	if err != nil {
+		return nil, 0, fmt.Errorf("error while decoding frame %v: %v", id, err)
+	}
+	return fr, 4 + n, nil
+}
+
+// AppendFrame appends the frame ID and body of fr to dst.
+func AppendFrame(dst []byte, fr Frame) []byte {
+	dst = binary.LittleEndian.AppendUint32(dst, fr.ID())
+	return fr.AppendEncode(dst)
+}
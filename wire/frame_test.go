@@ -0,0 +1,152 @@
+package wire
+
+import (
+	"bytes"
+	"testing"
+)
+
+type sample struct {
+	name  string
+	frame Frame
+}
+
+var parameters = TransportParameters{IdleTimeout: 30000, MaxStreams: 100, StreamReceiveWindow: 1 << 20, MaxDatagramSize: 1452}
+
+var samples = []sample{
+	{"acknowledgement", &Acknowledgement{Delay: 25, Max: 10, Ranges: []AcknowledgementRange{{1, 4}, {6, 10}}}},
+	{"connection_request", &ConnectionRequest{Version: Version, Token: []byte("token"), Parameters: parameters}},
+	{"connection_response", &ConnectionResponse{ConnectionID: 7, Response: ConnectionResponseFailed, Version: Version, Reason: "busy", Parameters: parameters}},
+	{"connection_close", &ConnectionClose{Code: ConnectionCloseGraceful, Message: "bye"}},
+	{"stream_request", &StreamRequest{StreamID: 3}},
+	{"stream_response", &StreamResponse{StreamID: 3, Response: StreamResponseFailed}},
+	{"stream_data", &StreamData{StreamID: 3, SequenceID: 9, Payload: []byte("payload")}},
+	{"stream_close", &StreamClose{StreamID: 3}},
+	{"mtu_request", &MTURequest{MTU: 16}},
+	{"mtu_response", &MTUResponse{MTU: 1400}},
+	{"path_challenge", &PathChallenge{Data: [8]byte{1, 2, 3, 4, 5, 6, 7, 8}}},
+	{"path_response", &PathResponse{Data: [8]byte{8, 7, 6, 5, 4, 3, 2, 1}}},
+	{"ping", &Ping{}},
+	{"padding", &Padding{Length: 4}},
+	{"retry", &Retry{Token: []byte("retry")}},
+	{"go_away", &GoAway{}},
+}
+
+func fuzzDecode(f *testing.F, id uint32) {
+	for _, s := range samples {
+		f.Add(s.frame.Encode())
+	}
+	f.Add(bytes.Repeat([]byte{0xff}, 17))
+
+	f.Fuzz(func(t *testing.T, p []byte) {
+		fr, err := NewFrame(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		n, err := fr.Decode(p)
+		if err != nil {
+			return
+		}
+
+		if n < 0 || n > len(p) {
+			t.Fatalf("decode consumed %v of %v bytes", n, len(p))
+		}
+
+		encoded := fr.Encode()
+		decoded, _ := NewFrame(id)
+		if _, err := decoded.Decode(encoded); err != nil {
+			t.Fatalf("failed to decode re-encoded frame: %v", err)
+		}
+
+		if !bytes.Equal(encoded, decoded.Encode()) {
+			t.Fatal("re-encoded frame does not round trip")
+		}
+	})
+}
+
+func FuzzAcknowledgement(f *testing.F)    { fuzzDecode(f, IDAcknowledgement) }
+func FuzzConnectionRequest(f *testing.F)  { fuzzDecode(f, IDConnectionRequest) }
+func FuzzConnectionResponse(f *testing.F) { fuzzDecode(f, IDConnectionResponse) }
+func FuzzConnectionClose(f *testing.F)    { fuzzDecode(f, IDConnectionClose) }
+func FuzzStreamRequest(f *testing.F)      { fuzzDecode(f, IDStreamRequest) }
+func FuzzStreamResponse(f *testing.F)     { fuzzDecode(f, IDStreamResponse) }
+func FuzzStreamData(f *testing.F)         { fuzzDecode(f, IDStreamData) }
+func FuzzStreamClose(f *testing.F)        { fuzzDecode(f, IDStreamClose) }
+func FuzzMTURequest(f *testing.F)         { fuzzDecode(f, IDMTURequest) }
+func FuzzMTUResponse(f *testing.F)        { fuzzDecode(f, IDMTUResponse) }
+func FuzzPathChallenge(f *testing.F)      { fuzzDecode(f, IDPathChallenge) }
+func FuzzPathResponse(f *testing.F)       { fuzzDecode(f, IDPathResponse) }
+func FuzzPing(f *testing.F)               { fuzzDecode(f, IDPing) }
+func FuzzPadding(f *testing.F)            { fuzzDecode(f, IDPadding) }
+func FuzzRetry(f *testing.F)              { fuzzDecode(f, IDRetry) }
+func FuzzGoAway(f *testing.F)             { fuzzDecode(f, IDGoAway) }
+
+func FuzzParseFrame(f *testing.F) {
+	for _, s := range samples {
+		f.Add(AppendFrame(nil, s.frame))
+	}
+
+	f.Fuzz(func(t *testing.T, p []byte) {
+		fr, n, err := ParseFrame(p)
+		if err != nil {
+			return
+		}
+
+		if n > len(p) || fr == nil {
+			t.Fatalf("parse consumed %v of %v bytes", n, len(p))
+		}
+	})
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, s := range samples {
+		encoded := AppendFrame(nil, s.frame)
+		fr, n, err := ParseFrame(encoded)
+		if err != nil {
+			t.Fatalf("%v: %v", s.name, err)
+		}
+
+		if n != len(encoded) {
+			t.Fatalf("%v: parsed %v of %v bytes", s.name, n, len(encoded))
+		}
+
+		if !bytes.Equal(encoded, AppendFrame(nil, fr)) {
+			t.Fatalf("%v does not round trip", s.name)
+		}
+	}
+}
+
+func TestAppendEncodeDoesNotAllocate(t *testing.T) {
+	dst := make([]byte, 0, 4096)
+	for _, s := range samples {
+		if allocs := testing.AllocsPerRun(100, func() { _ = AppendFrame(dst[:0], s.frame) }); allocs != 0 {
+			t.Fatalf("%v: append encoding allocated %v times", s.name, allocs)
+		}
+	}
+}
+
+func TestHeader(t *testing.T) {
+	h := Header{ConnectionID: -2, SequenceID: 42}
+	p := AppendHeader(nil, h)
+	if len(p) != HeaderSize {
+		t.Fatalf("expected %v byte header, got %v", HeaderSize, len(p))
+	}
+
+	parsed, err := ParseHeader(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if parsed != h {
+		t.Fatalf("expected %+v, got %+v", h, parsed)
+	}
+
+	p[0] ^= 0xff
+	if _, err := ParseHeader(p); err == nil {
+		t.Fatal("expected invalid magic to be rejected")
+	}
+
+	if _, err := ParseHeader(p[:HeaderSize-1]); err == nil {
+		t.Fatal("expected short header to be rejected")
+	}
+}
@@ -0,0 +1,17 @@
+package wire
+
+// GoAway tells the peer that no new streams will be accepted.
+type GoAway struct {
+}
+
+func (fr *GoAway) ID() uint32 {
+	return IDGoAway
+}
+
+func (fr *GoAway) Encode() (n []byte) { return }
+
+func (fr *GoAway) AppendEncode(dst []byte) []byte { return dst }
+
+func (fr *GoAway) Decode(_ []byte) (n int, err error) { return }
+
+func (fr *GoAway) Reset() {}
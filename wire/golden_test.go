@@ -0,0 +1,79 @@
+package wire
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"os"
+	"strings"
+	"testing"
+)
+
+func vectors(t *testing.T) map[string][]byte {
+	t.Helper()
+	f, err := os.Open("testdata/vectors.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	v := map[string][]byte{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		name, encoded, ok := strings.Cut(line, " ")
+		if !ok {
+			t.Fatalf("malformed vector %q", line)
+		}
+
+		p, err := hex.DecodeString(encoded)
+		if err != nil {
+			t.Fatalf("malformed vector %q: %v", name, err)
+		}
+		v[name] = p
+	}
+	return v
+}
+
+func TestGoldenHeader(t *testing.T) {
+	expected := vectors(t)["header"]
+	h := Header{ConnectionID: -2, SequenceID: 42}
+	if p := AppendHeader(nil, h); !bytes.Equal(p, expected) {
+		t.Fatalf("expected %x, got %x", expected, p)
+	}
+
+	if parsed, err := ParseHeader(expected); err != nil || parsed != h {
+		t.Fatalf("expected %+v, got %+v (%v)", h, parsed, err)
+	}
+}
+
+func TestGoldenFrames(t *testing.T) {
+	v := vectors(t)
+	for _, s := range samples {
+		expected, ok := v[s.name]
+		if !ok {
+			t.Fatalf("missing vector for %v", s.name)
+		}
+
+		if p := AppendFrame(nil, s.frame); !bytes.Equal(p, expected) {
+			t.Fatalf("%v: expected %x, got %x", s.name, expected, p)
+		}
+
+		fr, n, err := ParseFrame(expected)
+		if err != nil {
+			t.Fatalf("%v: %v", s.name, err)
+		}
+
+		if n != len(expected) || fr.ID() != s.frame.ID() {
+			t.Fatalf("%v: parsed frame %v from %v of %v bytes", s.name, fr.ID(), n, len(expected))
+		}
+
+		if p := AppendFrame(nil, fr); !bytes.Equal(p, expected) {
+			t.Fatalf("%v: decoded frame re-encodes to %x", s.name, p)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+// Package wire implements the spectral packet format: a fixed-size header
+// followed by a sequence of frames, each prefixed by its uint32 frame ID.
+// All integers are little-endian.
+package wire
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Version is the protocol version carried in connection requests and responses.
+const Version = 1
+
+// HeaderSize is the length in bytes of an encoded packet header.
+const HeaderSize = 16
+
+// Magic identifies spectral packets. It occupies the first four bytes of
+// every header, encoded little-endian.
+const Magic uint32 = 0x01102420
+
+// ConnectionID identifies a connection. Negative IDs are chosen by clients
+// for the handshake, non-negative IDs are assigned by the server.
+type ConnectionID int64
+
+// StreamID identifies a stream within a connection.
+type StreamID int64
+
+// Header is the packet header that precedes the frames of every datagram.
+// A SequenceID of zero marks a packet that is not acknowledged.
+type Header struct {
+	ConnectionID ConnectionID
+	SequenceID   uint32
+}
+
+// ParseHeader decodes the header at the start of p and validates its magic.
+func ParseHeader(p []byte) (Header, error) {
+	if len(p) < HeaderSize || binary.LittleEndian.Uint32(p[0:4]) != Magic {
+		return Header{}, errors.New("invalid header")
+	}
+	return Header{
+		ConnectionID: ConnectionID(binary.LittleEndian.Uint64(p[4:12])),
+		SequenceID:   binary.LittleEndian.Uint32(p[12:16]),
+	}, nil
+}
+
+// AppendHeader appends the encoded form of h to dst.
+func AppendHeader(dst []byte, h Header) []byte {
+	dst = binary.LittleEndian.AppendUint32(dst, Magic)
+	dst = binary.LittleEndian.AppendUint64(dst, uint64(h.ConnectionID))
+	return binary.LittleEndian.AppendUint32(dst, h.SequenceID)
+}
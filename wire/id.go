@@ -1,5 +1,6 @@
-package frame
+package wire
 
+// Frame IDs as they appear on the wire.
 const (
 	IDAcknowledgement = iota
 
@@ -14,4 +15,12 @@ const (
 
 	IDMTURequest
 	IDMTUResponse
+
+	IDPathChallenge
+	IDPathResponse
+
+	IDPing
+	IDPadding
+	IDRetry
+	IDGoAway
 )
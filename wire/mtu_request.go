@@ -1,10 +1,11 @@
-package frame
+package wire
 
 import (
 	"encoding/binary"
 	"errors"
 )
 
+// MTURequest is a probe padded to MTU bytes.
 type MTURequest struct {
 	MTU uint64
 }
@@ -14,9 +15,15 @@ func (fr *MTURequest) ID() uint32 {
 }
 
 func (fr *MTURequest) Encode() []byte {
-	p := make([]byte, fr.MTU)
-	binary.LittleEndian.PutUint64(p[0:8], fr.MTU)
-	return p
+	return fr.AppendEncode(nil)
+}
+
+func (fr *MTURequest) AppendEncode(dst []byte) []byte {
+	dst = binary.LittleEndian.AppendUint64(dst, fr.MTU)
+	if fr.MTU > 8 {
+		dst = append(dst, make([]byte, fr.MTU-8)...)
+	}
+	return dst
 }
 
 func (fr *MTURequest) Decode(p []byte) (int, error) {
@@ -24,6 +31,9 @@ func (fr *MTURequest) Decode(p []byte) (int, error) {
 		return 0, errors.New("not enough data to decode")
 	}
 	fr.MTU = binary.LittleEndian.Uint64(p[0:8])
+	if fr.MTU < 8 || uint64(len(p)) < fr.MTU {
+		return 0, errors.New("not enough data to decode padding")
+	}
 	return int(fr.MTU), nil
 }
 
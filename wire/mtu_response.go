@@ -1,10 +1,11 @@
-package frame
+package wire
 
 import (
 	"encoding/binary"
 	"errors"
 )
 
+// MTUResponse confirms that a probe of MTU bytes was received.
 type MTUResponse struct {
 	MTU uint64
 }
@@ -14,9 +15,11 @@ func (fr *MTUResponse) ID() uint32 {
 }
 
 func (fr *MTUResponse) Encode() []byte {
-	p := make([]byte, 8)
-	binary.LittleEndian.PutUint64(p[0:8], fr.MTU)
-	return p
+	return fr.AppendEncode(nil)
+}
+
+func (fr *MTUResponse) AppendEncode(dst []byte) []byte {
+	return binary.LittleEndian.AppendUint64(dst, fr.MTU)
 }
 
 func (fr *MTUResponse) Decode(p []byte) (int, error) {
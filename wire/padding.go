@@ -0,0 +1,25 @@
+package wire
+
+// Padding fills a packet with Length zero bytes.
+type Padding struct {
+	Length int
+}
+
+func (fr *Padding) ID() uint32 {
+	return IDPadding
+}
+
+func (fr *Padding) Encode() []byte {
+	return fr.AppendEncode(nil)
+}
+
+func (fr *Padding) AppendEncode(dst []byte) []byte {
+	return append(dst, make([]byte, fr.Length)...)
+}
+
+func (fr *Padding) Decode(p []byte) (int, error) {
+	fr.Length = len(p)
+	return len(p), nil
+}
+
+func (fr *Padding) Reset() {}
@@ -0,0 +1,30 @@
+package wire
+
+import "errors"
+
+// PathChallenge asks the peer to echo Data in a PathResponse.
+type PathChallenge struct {
+	Data [8]byte
+}
+
+func (fr *PathChallenge) ID() uint32 {
+	return IDPathChallenge
+}
+
+func (fr *PathChallenge) Encode() []byte {
+	return fr.AppendEncode(nil)
+}
+
+func (fr *PathChallenge) AppendEncode(dst []byte) []byte {
+	return append(dst, fr.Data[:]...)
+}
+
+func (fr *PathChallenge) Decode(p []byte) (int, error) {
+	if len(p) < 8 {
+		return 0, errors.New("not enough data to decode")
+	}
+	copy(fr.Data[:], p[:8])
+	return 8, nil
+}
+
+func (fr *PathChallenge) Reset() {}
@@ -0,0 +1,30 @@
+package wire
+
+import "errors"
+
+// PathResponse echoes the Data of a PathChallenge.
+type PathResponse struct {
+	Data [8]byte
+}
+
+func (fr *PathResponse) ID() uint32 {
+	return IDPathResponse
+}
+
+func (fr *PathResponse) Encode() []byte {
+	return fr.AppendEncode(nil)
+}
+
+func (fr *PathResponse) AppendEncode(dst []byte) []byte {
+	return append(dst, fr.Data[:]...)
+}
+
+func (fr *PathResponse) Decode(p []byte) (int, error) {
+	if len(p) < 8 {
+		return 0, errors.New("not enough data to decode")
+	}
+	copy(fr.Data[:], p[:8])
+	return 8, nil
+}
+
+func (fr *PathResponse) Reset() {}
@@ -0,0 +1,17 @@
+package wire
+
+// Ping elicits an acknowledgement.
+type Ping struct {
+}
+
+func (fr *Ping) ID() uint32 {
+	return IDPing
+}
+
+func (fr *Ping) Encode() (n []byte) { return }
+
+func (fr *Ping) AppendEncode(dst []byte) []byte { return dst }
+
+func (fr *Ping) Decode(_ []byte) (n int, err error) { return }
+
+func (fr *Ping) Reset() {}
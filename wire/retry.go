@@ -0,0 +1,39 @@
+package wire
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Retry asks the client to repeat its ConnectionRequest with Token.
+type Retry struct {
+	Token []byte
+}
+
+func (fr *Retry) ID() uint32 {
+	return IDRetry
+}
+
+func (fr *Retry) Encode() []byte {
+	return fr.AppendEncode(nil)
+}
+
+func (fr *Retry) AppendEncode(dst []byte) []byte {
+	dst = binary.LittleEndian.AppendUint32(dst, uint32(len(fr.Token)))
+	return append(dst, fr.Token...)
+}
+
+func (fr *Retry) Decode(p []byte) (int, error) {
+	if len(p) < 4 {
+		return 0, errors.New("not enough data to decode")
+	}
+
+	tokenLength := binary.LittleEndian.Uint32(p[0:4])
+	if uint64(len(p)) < 4+uint64(tokenLength) {
+		return 0, errors.New("not enough data to decode token")
+	}
+	fr.Token = append(fr.Token[:0], p[4:4+tokenLength]...)
+	return 4 + int(tokenLength), nil
+}
+
+func (fr *Retry) Reset() {}
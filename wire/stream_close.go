@@ -1,14 +1,13 @@
-package frame
+package wire
 
 import (
 	"encoding/binary"
 	"errors"
-
-	"github.com/cooldogedev/spectral/internal/protocol"
 )
 
+// StreamClose closes a stream.
 type StreamClose struct {
-	StreamID protocol.StreamID
+	StreamID StreamID
 }
 
 func (fr *StreamClose) ID() uint32 {
@@ -16,16 +15,18 @@ func (fr *StreamClose) ID() uint32 {
 }
 
 func (fr *StreamClose) Encode() []byte {
-	p := make([]byte, 8)
-	binary.LittleEndian.PutUint64(p, uint64(fr.StreamID))
-	return p
+	return fr.AppendEncode(nil)
+}
+
+func (fr *StreamClose) AppendEncode(dst []byte) []byte {
+	return binary.LittleEndian.AppendUint64(dst, uint64(fr.StreamID))
 }
 
 func (fr *StreamClose) Decode(p []byte) (int, error) {
 	if len(p) < 8 {
 		return 0, errors.New("not enough data to decode")
 	}
-	fr.StreamID = protocol.StreamID(binary.LittleEndian.Uint64(p[:8]))
+	fr.StreamID = StreamID(binary.LittleEndian.Uint64(p[:8]))
 	return 8, nil
 }
 
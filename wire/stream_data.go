@@ -1,14 +1,14 @@
-package frame
+package wire
 
 import (
 	"encoding/binary"
 	"errors"
-
-	"github.com/cooldogedev/spectral/internal/protocol"
 )
 
+// StreamData carries a chunk of stream payload. SequenceID orders chunks
+// within the stream.
 type StreamData struct {
-	StreamID   protocol.StreamID
+	StreamID   StreamID
 	SequenceID uint32
 	Payload    []byte
 }
@@ -18,13 +18,14 @@ func (fr *StreamData) ID() uint32 {
 }
 
 func (fr *StreamData) Encode() []byte {
-	payloadLength := uint32(len(fr.Payload))
-	p := make([]byte, 8+4+4+payloadLength)
-	binary.LittleEndian.PutUint64(p[0:8], uint64(fr.StreamID))
-	binary.LittleEndian.PutUint32(p[8:12], fr.SequenceID)
-	binary.LittleEndian.PutUint32(p[12:16], payloadLength)
-	copy(p[16:], fr.Payload)
-	return p
+	return fr.AppendEncode(nil)
+}
+
+func (fr *StreamData) AppendEncode(dst []byte) []byte {
+	dst = binary.LittleEndian.AppendUint64(dst, uint64(fr.StreamID))
+	dst = binary.LittleEndian.AppendUint32(dst, fr.SequenceID)
+	dst = binary.LittleEndian.AppendUint32(dst, uint32(len(fr.Payload)))
+	return append(dst, fr.Payload...)
 }
 
 func (fr *StreamData) Decode(p []byte) (int, error) {
@@ -32,10 +33,10 @@ func (fr *StreamData) Decode(p []byte) (int, error) {
 		return 0, errors.New("not enough data to decode")
 	}
 
-	fr.StreamID = protocol.StreamID(binary.LittleEndian.Uint64(p[0:8]))
+	fr.StreamID = StreamID(binary.LittleEndian.Uint64(p[0:8]))
 	fr.SequenceID = binary.LittleEndian.Uint32(p[8:12])
 	payloadLength := binary.LittleEndian.Uint32(p[12:16])
-	if len(p) < int(16+payloadLength) {
+	if uint64(len(p)) < 16+uint64(payloadLength) {
 		return 16, errors.New("not enough data to decode payload")
 	}
 	fr.Payload = append(fr.Payload, p[16:16+payloadLength]...)
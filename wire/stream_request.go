@@ -1,14 +1,13 @@
-package frame
+package wire
 
 import (
 	"encoding/binary"
 	"errors"
-
-	"github.com/cooldogedev/spectral/internal/protocol"
 )
 
+// StreamRequest opens a stream.
 type StreamRequest struct {
-	StreamID protocol.StreamID
+	StreamID StreamID
 }
 
 func (fr *StreamRequest) ID() uint32 {
@@ -16,16 +15,18 @@ func (fr *StreamRequest) ID() uint32 {
 }
 
 func (fr *StreamRequest) Encode() []byte {
-	p := make([]byte, 8)
-	binary.LittleEndian.PutUint64(p, uint64(fr.StreamID))
-	return p
+	return fr.AppendEncode(nil)
+}
+
+func (fr *StreamRequest) AppendEncode(dst []byte) []byte {
+	return binary.LittleEndian.AppendUint64(dst, uint64(fr.StreamID))
 }
 
 func (fr *StreamRequest) Decode(p []byte) (int, error) {
 	if len(p) < 8 {
 		return 0, errors.New("not enough data to decode")
 	}
-	fr.StreamID = protocol.StreamID(binary.LittleEndian.Uint64(p))
+	fr.StreamID = StreamID(binary.LittleEndian.Uint64(p))
 	return 8, nil
 }
 
@@ -1,19 +1,19 @@
-package frame
+package wire
 
 import (
 	"encoding/binary"
 	"errors"
-
-	"github.com/cooldogedev/spectral/internal/protocol"
 )
 
+// Stream response codes.
 const (
 	StreamResponseSuccess = iota
 	StreamResponseFailed
 )
 
+// StreamResponse answers a StreamRequest.
 type StreamResponse struct {
-	StreamID protocol.StreamID
+	StreamID StreamID
 	Response byte
 }
 
@@ -22,17 +22,19 @@ func (fr *StreamResponse) ID() uint32 {
 }
 
 func (fr *StreamResponse) Encode() []byte {
-	p := make([]byte, 9)
-	binary.LittleEndian.PutUint64(p[0:8], uint64(fr.StreamID))
-	p[8] = fr.Response
-	return p
+	return fr.AppendEncode(nil)
+}
+
+func (fr *StreamResponse) AppendEncode(dst []byte) []byte {
+	dst = binary.LittleEndian.AppendUint64(dst, uint64(fr.StreamID))
+	return append(dst, fr.Response)
 }
 
 func (fr *StreamResponse) Decode(p []byte) (int, error) {
 	if len(p) < 9 {
 		return 0, errors.New("not enough data to decode")
 	}
-	fr.StreamID = protocol.StreamID(binary.LittleEndian.Uint64(p))
+	fr.StreamID = StreamID(binary.LittleEndian.Uint64(p))
 	fr.Response = p[8]
 	return 9, nil
 }
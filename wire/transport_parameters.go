@@ -0,0 +1,107 @@
+package wire
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Transport parameter IDs. Unknown IDs are skipped when decoding.
+const (
+	TransportParameterIdleTimeout = iota + 1
+	TransportParameterMaxStreams
+	TransportParameterStreamReceiveWindow
+	TransportParameterMaxDatagramSize
+	TransportParameterExtensions
+)
+
+// TransportParameters are exchanged during the handshake as a
+// length-prefixed list of (id, length, value) entries. Zero values are
+// omitted when encoding.
+type TransportParameters struct {
+	IdleTimeout         uint64
+	MaxStreams          uint64
+	StreamReceiveWindow uint64
+	MaxDatagramSize     uint64
+	Extensions          uint64
+}
+
+// Encode returns the encoded parameter block.
+func (tp *TransportParameters) Encode() []byte {
+	return tp.AppendEncode(make([]byte, 0, 4+5*12))
+}
+
+// AppendEncode appends the encoded parameter block to dst.
+func (tp *TransportParameters) AppendEncode(dst []byte) []byte {
+	start := len(dst)
+	dst = append(dst, 0, 0, 0, 0)
+	for _, param := range [...]struct {
+		id    uint16
+		value uint64
+	}{
+		{TransportParameterIdleTimeout, tp.IdleTimeout},
+		{TransportParameterMaxStreams, tp.MaxStreams},
+		{TransportParameterStreamReceiveWindow, tp.StreamReceiveWindow},
+		{TransportParameterMaxDatagramSize, tp.MaxDatagramSize},
+		{TransportParameterExtensions, tp.Extensions},
+	} {
+		if param.value == 0 {
+			continue
+		}
+		dst = binary.LittleEndian.AppendUint16(dst, param.id)
+		dst = binary.LittleEndian.AppendUint16(dst, 8)
+		dst = binary.LittleEndian.AppendUint64(dst, param.value)
+	}
+	binary.LittleEndian.PutUint32(dst[start:start+4], uint32(len(dst)-start-4))
+	return dst
+}
+
+// Decode reads a parameter block from p and reports how many bytes it consumed.
+func (tp *TransportParameters) Decode(p []byte) (int, error) {
+	if len(p) < 4 {
+		return 0, errors.New("not enough data to decode transport parameters")
+	}
+
+	length := binary.LittleEndian.Uint32(p[0:4])
+	if uint64(len(p)) < 4+uint64(length) {
+		return 0, errors.New("not enough data to decode transport parameters")
+	}
+
+	*tp = TransportParameters{}
+	block := p[4 : 4+length]
+	for len(block) > 0 {
+		if len(block) < 4 {
+			return 0, errors.New("truncated transport parameter")
+		}
+
+		id := binary.LittleEndian.Uint16(block[0:2])
+		valueLength := int(binary.LittleEndian.Uint16(block[2:4]))
+		if len(block) < 4+valueLength {
+			return 0, fmt.Errorf("truncated transport parameter %v", id)
+		}
+
+		value := block[4 : 4+valueLength]
+		block = block[4+valueLength:]
+		var field *uint64
+		switch id {
+		case TransportParameterIdleTimeout:
+			field = &tp.IdleTimeout
+		case TransportParameterMaxStreams:
+			field = &tp.MaxStreams
+		case TransportParameterStreamReceiveWindow:
+			field = &tp.StreamReceiveWindow
+		case TransportParameterMaxDatagramSize:
+			field = &tp.MaxDatagramSize
+		case TransportParameterExtensions:
+			field = &tp.Extensions
+		default:
+			continue
+		}
+
+		if valueLength != 8 {
+			return 0, fmt.Errorf("invalid length %v for transport parameter %v", valueLength, id)
+		}
+		*field = binary.LittleEndian.Uint64(value)
+	}
+	return 4 + int(length), nil
+}
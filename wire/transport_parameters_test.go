@@ -0,0 +1,69 @@
+package wire
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func appendParameter(dst []byte, id uint16, value []byte) []byte {
+	dst = binary.LittleEndian.AppendUint16(dst, id)
+	dst = binary.LittleEndian.AppendUint16(dst, uint16(len(value)))
+	return append(dst, value...)
+}
+
+func parameterBlock(params ...[]byte) []byte {
+	var block []byte
+	for _, param := range params {
+		block = append(block, param...)
+	}
+	return append(binary.LittleEndian.AppendUint32(nil, uint32(len(block))), block...)
+}
+
+func TestTransportParametersRoundTrip(t *testing.T) {
+	p := parameters.Encode()
+	var decoded TransportParameters
+	n, err := decoded.Decode(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != len(p) || decoded != parameters {
+		t.Fatalf("expected %+v in %v bytes, got %+v in %v bytes", parameters, len(p), decoded, n)
+	}
+
+	if empty := (&TransportParameters{}).Encode(); len(empty) != 4 {
+		t.Fatalf("expected zero parameters to be omitted, got %x", empty)
+	}
+}
+
+func TestTransportParametersSkipsUnknown(t *testing.T) {
+	p := parameterBlock(
+		appendParameter(nil, 0x7fff, []byte{1, 2, 3}),
+		appendParameter(nil, TransportParameterMaxStreams, binary.LittleEndian.AppendUint64(nil, 42)),
+		appendParameter(nil, 0x7ffe, nil),
+	)
+	var decoded TransportParameters
+	n, err := decoded.Decode(append(p, 0xff))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != len(p) || decoded != (TransportParameters{MaxStreams: 42}) {
+		t.Fatalf("expected only max streams in %v bytes, got %+v in %v bytes", len(p), decoded, n)
+	}
+}
+
+func TestTransportParametersInvalid(t *testing.T) {
+	for name, p := range map[string][]byte{
+		"short length":      {1, 0},
+		"truncated block":   binary.LittleEndian.AppendUint32(nil, 12),
+		"truncated header":  parameterBlock([]byte{1, 0}),
+		"truncated value":   parameterBlock(appendParameter(nil, TransportParameterIdleTimeout, make([]byte, 8))[:10]),
+		"wrong value width": parameterBlock(appendParameter(nil, TransportParameterIdleTimeout, []byte{1, 2, 3, 4})),
+	} {
+		var decoded TransportParameters
+		if _, err := decoded.Decode(p); err == nil {
+			t.Errorf("%v: expected an error", name)
+		}
+	}
+}